@@ -2,7 +2,6 @@
 package main
 
 import (
-	"compress/bzip2"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -10,22 +9,23 @@ import (
 	"os"
 	"strings"
 
+	cndparser "github.com/cndotaplan/cndotaplan/internal/parser"
 	"github.com/dotabuff/manta"
 )
 
 func main() {
-	demPath := flag.String("dem", "", ".dem 或 .dem.bz2 路径")
+	demPath := flag.String("dem", "", ".dem / .dem.bz2 等录像路径，- 为 stdin")
 	flag.Parse()
 	if *demPath == "" {
 		fmt.Fprintln(os.Stderr, "用法: debug_game_time -dem <path>")
 		os.Exit(1)
 	}
-	f, _ := os.Open(*demPath)
-	defer f.Close()
-	r := io.Reader(f)
-	if strings.HasSuffix(strings.ToLower(*demPath), ".bz2") {
-		r = bzip2.NewReader(f)
+	r, err := cndparser.OpenReplay(*demPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "打开录像失败: %v\n", err)
+		os.Exit(1)
 	}
+	defer r.Close()
 	parser, err := manta.NewStreamParser(r)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "NewStreamParser: %v\n", err)
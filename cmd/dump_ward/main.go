@@ -2,31 +2,30 @@
 package main
 
 import (
-	"compress/bzip2"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"os"
-	"strings"
 
+	cndparser "github.com/cndotaplan/cndotaplan/internal/parser"
 	"github.com/dotabuff/manta"
 )
 
 func main() {
-	demPath := flag.String("dem", "", "路径: .dem 或 .dem.bz2 文件")
+	demPath := flag.String("dem", "", "路径: .dem / .dem.bz2 等录像文件，- 为 stdin")
 	flag.Parse()
 	if *demPath == "" {
 		fmt.Fprintln(os.Stderr, "用法: dump_ward -dem <path>")
 		os.Exit(1)
 	}
 
-	f, _ := os.Open(*demPath)
-	defer f.Close()
-	var r io.Reader = f
-	if strings.HasSuffix(strings.ToLower(*demPath), ".bz2") {
-		r = bzip2.NewReader(f)
+	r, err := cndparser.OpenReplay(*demPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "打开录像失败: %v\n", err)
+		os.Exit(1)
 	}
+	defer r.Close()
 
 	parser, err := manta.NewStreamParser(r)
 	if err != nil {
@@ -0,0 +1,149 @@
+// 拉取 match_id 对应的录像并下载到本地录像目录。已下载的比赛会跳过，可直接放进 cron 定时执行。
+// 用法:
+//
+//	go run ./cmd/fetch -matchid 8678990124 [-dir replays]
+//	go run ./cmd/fetch -ids ids.txt
+//	go run ./cmd/fetch -pro 50
+//
+// 成功下载（或已存在）的录像路径逐行输出到 stdout；任一场失败时退出码为 1。
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cndotaplan/cndotaplan/internal/downloader"
+)
+
+func main() {
+	matchID := flag.Int64("matchid", 0, "单场比赛 ID")
+	idsPath := flag.String("ids", "", "match_id 列表文件，每行一个，# 开头为注释；- 表示 stdin")
+	pro := flag.Int("pro", 0, "拉取 OpenDota proMatches 最近 N 场职业比赛")
+	dir := flag.String("dir", "replays", "录像目录")
+	baseURL := flag.String("api", downloader.DefaultBaseURL, "OpenDota API 地址（可指向本地 mock）")
+	delay := flag.Duration("delay", time.Second, "相邻两场之间的间隔，避免触发 OpenDota 限流")
+	retries := flag.Int("retries", 3, "单场下载失败后的续传重试次数")
+	timeout := flag.Duration("timeout", 0, "整批超时，0 表示不限")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	client := downloader.New(*dir)
+	client.BaseURL = *baseURL
+	client.Retries = *retries
+
+	ids, err := collectIDs(ctx, client, *matchID, *idsPath, *pro)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "获取 match_id 失败: %v\n", err)
+		os.Exit(1)
+	}
+	if len(ids) == 0 {
+		fmt.Fprintln(os.Stderr, "用法: fetch (-matchid id | -ids file | -pro n) [-dir replays]")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	failed := 0
+	for i, id := range ids {
+		if ctx.Err() != nil {
+			fmt.Fprintf(os.Stderr, "已中止，剩余 %d 场未处理\n", len(ids)-i)
+			failed += len(ids) - i
+			break
+		}
+		if p := client.Existing(id); p != "" {
+			fmt.Println(p)
+			continue
+		}
+		p, err := client.Download(ctx, id)
+		switch {
+		case errors.Is(err, downloader.ErrNoReplay):
+			fmt.Fprintf(os.Stderr, "%d: OpenDota 暂无 replay_url（未解析或已过期）\n", id)
+			failed++
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "%d: %v\n", id, err)
+			failed++
+		default:
+			fmt.Println(p)
+		}
+		if i < len(ids)-1 && *delay > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(*delay):
+			}
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d/%d 场失败\n", failed, len(ids))
+		os.Exit(1)
+	}
+}
+
+// collectIDs 合并 -matchid、-ids、-pro 三种来源并去重，保持顺序
+func collectIDs(ctx context.Context, client *downloader.Client, matchID int64, idsPath string, pro int) ([]int64, error) {
+	var ids []int64
+	if matchID != 0 {
+		ids = append(ids, matchID)
+	}
+	if idsPath != "" {
+		fromFile, err := readIDs(idsPath)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, fromFile...)
+	}
+	if pro > 0 {
+		fromPro, err := client.ProMatchIDs(ctx, pro)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, fromPro...)
+	}
+	seen := make(map[int64]bool, len(ids))
+	out := ids[:0]
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out, nil
+}
+
+func readIDs(path string) ([]int64, error) {
+	f := os.Stdin
+	if path != "-" {
+		var err error
+		if f, err = os.Open(path); err != nil {
+			return nil, err
+		}
+		defer f.Close()
+	}
+	var ids []int64
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		s := strings.TrimSpace(sc.Text())
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid match_id %q", path, line, s)
+		}
+		ids = append(ids, id)
+	}
+	return ids, sc.Err()
+}
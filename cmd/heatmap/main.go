@@ -3,32 +3,54 @@
 //
 //	heatmap -dem <path> [-matchid id] [-out heatmap.html]
 //	heatmap -json <path> [-out heatmap.html]   # 使用 OpenDota 等眼位 JSON，见 docs/opendota_vision.md
+//	heatmap -dsn <path> [-matchid id] [-out heatmap.html]   # 读取 cmd/parse -dsn 写入的数据库，-matchid 为 0 时取全部
+//	heatmap -dsn <path> -patch 7.40 -since 2025-01-01 -until 2026-01-01   # 按版本与比赛日期过滤
+//	heatmap -dsn <path> -normalize-side   # 多场汇总时把夜魇方的眼位对称到左下，两边的打法叠在一起
+//
+// 「视野覆盖」页按地形遮挡与该场当时的砍树、临时树（-dem 取自录像，-dsn 取自 tree_events）画出每个假眼插下时的可见区域，-terrain 指定地形格子文件（cmd/terrain 生成，未指定时该页为空）。
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"math"
 	"os"
+	"time"
 
+	"github.com/cndotaplan/cndotaplan/internal/analytics"
+	"github.com/cndotaplan/cndotaplan/internal/coord"
 	"github.com/cndotaplan/cndotaplan/internal/model"
 	"github.com/cndotaplan/cndotaplan/internal/parser"
+	"github.com/cndotaplan/cndotaplan/internal/region"
+	"github.com/cndotaplan/cndotaplan/internal/storage"
+	"github.com/cndotaplan/cndotaplan/internal/terrain"
+	"github.com/cndotaplan/cndotaplan/internal/vision"
 )
 
 func main() {
-	demPath := flag.String("dem", "", "路径: .dem 或 .dem.bz2 文件")
+	demPath := flag.String("dem", "", "路径: .dem 或压缩录像（按内容识别），- 为 stdin")
 	jsonPath := flag.String("json", "", "路径: 眼位 JSON 文件（与 -dem 二选一，如 OpenDota 脚本输出）")
-	matchID := flag.Int64("matchid", 0, "比赛 ID（可选，仅 -dem 时有效）")
+	storeDriver := flag.String("store", "sqlite", "眼位库后端：sqlite 或 postgres")
+	storeDSN := flag.String("dsn", "", "眼位库：SQLite 文件路径或 PostgreSQL 连接串（与 -dem、-json 三选一）")
+	matchID := flag.Int64("matchid", 0, "比赛 ID（可选，-dem 时填充记录，-dsn 时按场过滤）")
 	outPath := flag.String("out", "ward_heatmap.html", "输出 HTML 路径")
+	patch := flag.String("patch", "", "地图版本（决定底图边界，默认最新）；-dsn 时同时只取该版本的比赛")
+	since := flag.String("since", "", "-dsn 时只取该日期（YYYY-MM-DD，UTC）及之后开始的比赛")
+	until := flag.String("until", "", "-dsn 时只取该日期（YYYY-MM-DD，UTC）之前开始的比赛")
+	normalizeSide := flag.Bool("normalize-side", false, "夜魇方的眼位按地图中心对称到左下（含版本的不对称修正），全部按天辉方绘制")
+	terrainPath := flag.String("terrain", "", "地形格子文件（cmd/terrain 从地图导出），用于视野覆盖页；不指定时不生成视野覆盖")
 	flag.Parse()
 
 	var records []model.WardRecord
+	trees := map[int64][]model.TreeEvent{} // 各场的砍树与临时树，视野覆盖按插眼时的树状态计算
 	switch {
+	case countSet(*demPath, *jsonPath, *storeDSN) > 1:
+		fmt.Fprintln(os.Stderr, "请只使用 -dem、-json、-dsn 之一")
+		os.Exit(1)
 	case *jsonPath != "":
-		if *demPath != "" {
-			fmt.Fprintln(os.Stderr, "请只使用 -dem 或 -json 之一")
-			os.Exit(1)
-		}
 		data, err := os.ReadFile(*jsonPath)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "读取 JSON: %v\n", err)
@@ -39,24 +61,86 @@ func main() {
 			os.Exit(1)
 		}
 	case *demPath != "":
-		var err error
-		records, err = parser.ExtractWards(*demPath, *matchID)
-		if err != nil {
+		rep, err := parser.ExtractReplay(*demPath, *matchID)
+		if rep != nil {
+			records = rep.Wards
+			if len(records) > 0 {
+				trees[records[0].MatchID] = rep.Trees
+			}
+		}
+		var partial *parser.PartialError
+		if errors.As(err, &partial) {
+			// 截断的录像仍可画出已解析部分
+			fmt.Fprintf(os.Stderr, "警告: %v\n", err)
+		} else if err != nil {
 			fmt.Fprintf(os.Stderr, "解析失败: %v\n", err)
 			os.Exit(1)
 		}
+	case *storeDSN != "":
+		store, err := storage.Open(*storeDriver, *storeDSN)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "打开数据库失败: %v\n", err)
+			os.Exit(1)
+		}
+		f := storage.WardFilter{Patch: *patch}
+		if *matchID != 0 {
+			f.MatchIDs = []int64{*matchID}
+		}
+		if f.Since, err = parseDate(*since); err == nil {
+			f.Until, err = parseDate(*until)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "日期格式应为 YYYY-MM-DD: %v\n", err)
+			os.Exit(1)
+		}
+		records, err = store.Wards(context.Background(), f)
+		if err == nil && *terrainPath != "" {
+			err = loadTrees(store, records, trees)
+		}
+		store.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "读取数据库失败: %v\n", err)
+			os.Exit(1)
+		}
 	default:
-		fmt.Fprintln(os.Stderr, "用法: heatmap -dem <path> 或 heatmap -json <path> [-out heatmap.html]")
+		fmt.Fprintln(os.Stderr, "用法: heatmap -dem <path> | -json <path> | -dsn <path> [-out heatmap.html]")
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
 
+	if *normalizeSide {
+		m, err := region.Load(*patch)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "加载区域数据: %v\n", err)
+			os.Exit(1)
+		}
+		analytics.NormalizeSide(records, m)
+	}
+	var grid *terrain.Grid
+	if *terrainPath != "" {
+		var err error
+		if grid, err = terrain.Open(*terrainPath, *patch); err != nil {
+			fmt.Fprintf(os.Stderr, "加载地形数据: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	// 录像（世界坐标）与 OpenDota（网格）数据统一换算到 0–1，按固定地图边界绘制，可画在同一张图上
+	bounds := coord.BoundsFor(*patch)
+	bounds.ConvertRecords(records, coord.World)
+	coverage := observerCoverage(records, trees, grid, bounds)
+	bounds.ConvertRecords(records, coord.Normalized)
+
 	jsonBytes, err := json.Marshal(records)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "JSON: %v\n", err)
 		os.Exit(1)
 	}
-	html := generateHTML(string(jsonBytes))
+	coverageBytes, err := json.Marshal(coverage)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "JSON: %v\n", err)
+		os.Exit(1)
+	}
+	html := generateHTML(string(jsonBytes), string(coverageBytes))
 	if err := os.WriteFile(*outPath, []byte(html), 0644); err != nil {
 		fmt.Fprintf(os.Stderr, "写入失败: %v\n", err)
 		os.Exit(1)
@@ -64,7 +148,69 @@ func main() {
 	fmt.Printf("已生成 %d 条眼位，热力图: %s\n", len(records), *outPath)
 }
 
-func generateHTML(wardsJSON string) string {
+// wardCoverage 一个假眼的可见区域（0–1 坐标）
+type wardCoverage struct {
+	TeamID  int32           `json:"team_id"`
+	Polygon []terrain.Point `json:"polygon"`
+}
+
+// observerCoverage 按插眼时刻的昼夜半径、地形遮挡与该场当时的树状态（trees，match_id → 砍树与临时树）
+// 计算每个假眼的可见区域；records 为世界坐标。没有地形数据时为空
+func observerCoverage(records []model.WardRecord, trees map[int64][]model.TreeEvent, grid *terrain.Grid, bounds coord.Bounds) []wardCoverage {
+	var out []wardCoverage
+	if grid == nil {
+		return out
+	}
+	for _, w := range records {
+		if w.WardType != "observer" || (w.PosX == 0 && w.PosY == 0) {
+			continue
+		}
+		r := vision.Default.Radius(w.WardType, vision.IsNight(w.GameTimeSec))
+		changes := vision.TreesAt(trees[w.MatchID], grid, w.GameTimeSec, w.PosX, w.PosY, r)
+		poly := grid.PolygonWithTrees(w.PosX, w.PosY, r, 90, changes)
+		for i, p := range poly {
+			nx, ny := bounds.WorldToNormalized(p[0], p[1])
+			poly[i] = terrain.Point{math.Round(nx*1e4) / 1e4, math.Round(ny*1e4) / 1e4}
+		}
+		out = append(out, wardCoverage{TeamID: w.TeamID, Polygon: poly})
+	}
+	return out
+}
+
+// loadTrees 读取 records 中各场的砍树与临时树
+func loadTrees(store storage.Store, records []model.WardRecord, trees map[int64][]model.TreeEvent) error {
+	for _, w := range records {
+		if _, ok := trees[w.MatchID]; ok {
+			continue
+		}
+		evs, err := store.Trees(context.Background(), w.MatchID)
+		if err != nil {
+			return err
+		}
+		trees[w.MatchID] = evs
+	}
+	return nil
+}
+
+// parseDate 解析 YYYY-MM-DD，空串为零值（不过滤）
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+func countSet(values ...string) int {
+	n := 0
+	for _, v := range values {
+		if v != "" {
+			n++
+		}
+	}
+	return n
+}
+
+func generateHTML(wardsJSON, coverageJSON string) string {
 	return `<!DOCTYPE html>
 <html lang="zh-CN">
 <head>
@@ -96,6 +242,7 @@ func generateHTML(wardsJSON string) string {
     <button type="button" data-panel="radiant">天辉 (Radiant)</button>
     <button type="button" data-panel="dire">夜魇 (Dire)</button>
     <button type="button" data-panel="both">双方叠加</button>
+    <button type="button" data-panel="coverage">视野覆盖</button>
   </div>
   <div id="panel-all" class="panel active">
     <div class="canvas-wrap"><canvas id="c-all" width="800" height="800"></canvas></div>
@@ -116,8 +263,13 @@ func generateHTML(wardsJSON string) string {
     <div class="canvas-wrap"><canvas id="c-both" width="800" height="800"></canvas></div>
     <p class="legend" id="legend-both">蓝色=天辉 红色=夜魇 重叠处混合</p>
   </div>
+  <div id="panel-coverage" class="panel">
+    <div class="canvas-wrap"><canvas id="c-coverage" width="800" height="800"></canvas></div>
+    <p class="legend">每个假眼插下时的可见区域，已扣除高地、树与阻挡物的遮挡（蓝色=天辉 红色=夜魇，叠加越多颜色越深）</p>
+  </div>
 
   <script type="application/json" id="wards-data">` + wardsJSON + `</script>
+  <script type="application/json" id="coverage-data">` + coverageJSON + `</script>
   <script>
     const wards = JSON.parse(document.getElementById('wards-data').textContent);
     const RADIANT = 2, DIRE = 3;
@@ -127,20 +279,8 @@ func generateHTML(wardsJSON string) string {
     const all = wards.filter(hasPos);
     const noTeamData = radiant.length === 0 && dire.length === 0;
 
-    function bounds(list) {
-      let xMin = 1e9, xMax = -1e9, yMin = 1e9, yMax = -1e9;
-      list.forEach(w => {
-        if (w.pos_x !== 0 || w.pos_y !== 0) {
-          xMin = Math.min(xMin, w.pos_x); xMax = Math.max(xMax, w.pos_x);
-          yMin = Math.min(yMin, w.pos_y); yMax = Math.max(yMax, w.pos_y);
-        }
-      });
-      if (xMin > xMax) xMin = 0, xMax = 16384, yMin = 0, yMax = 16384;
-      const pad = Math.max((xMax - xMin) * 0.05, (yMax - yMin) * 0.05, 100);
-      return { xMin: xMin - pad, xMax: xMax + pad, yMin: yMin - pad, yMax: yMax + pad };
-    }
-
-    const globalBounds = bounds(all);
+    // 坐标已由 Go 侧换算为 0–1（internal/coord），固定按整张地图绘制
+    const globalBounds = { xMin: 0, xMax: 1, yMin: 0, yMax: 1 };
 
     function toCanvas(x, y, w, h, b) {
       const nx = (x - b.xMin) / (b.xMax - b.xMin);
@@ -254,6 +394,30 @@ func generateHTML(wardsJSON string) string {
     drawHeatmap('c-dire', dire, gradientRedYellow);
     drawBoth('c-both');
 
+    function drawCoverage(canvasId) {
+      const coverage = JSON.parse(document.getElementById('coverage-data').textContent) || [];
+      const c = document.getElementById(canvasId);
+      const ctx = c.getContext('2d');
+      const w = c.width, h = c.height;
+      ctx.fillStyle = '#1a1a2e';
+      ctx.fillRect(0, 0, w, h);
+      const alpha = Math.max(0.03, Math.min(0.25, 4 / Math.max(1, coverage.length)));
+      coverage.forEach(cv => {
+        ctx.fillStyle = cv.team_id === RADIANT ? 'rgba(60,160,255,' + alpha + ')' : 'rgba(240,80,60,' + alpha + ')';
+        ctx.beginPath();
+        cv.polygon.forEach((p, i) => {
+          const { px, py } = toCanvas(p[0], p[1], w, h, globalBounds);
+          if (i === 0) ctx.moveTo(px, py); else ctx.lineTo(px, py);
+        });
+        ctx.closePath();
+        ctx.fill();
+      });
+      ctx.strokeStyle = 'rgba(255,255,255,0.15)';
+      ctx.lineWidth = 1;
+      ctx.strokeRect(0, 0, w, h);
+    }
+    drawCoverage('c-coverage');
+
     if (noTeamData) {
       ['radiant','dire','both'].forEach(id => {
         const hint = document.getElementById('hint-' + id);
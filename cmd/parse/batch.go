@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cndotaplan/cndotaplan/internal/downloader"
+	"github.com/cndotaplan/cndotaplan/internal/parser"
+	"github.com/cndotaplan/cndotaplan/internal/spot"
+	"github.com/cndotaplan/cndotaplan/internal/storage"
+	"github.com/cndotaplan/cndotaplan/internal/vision"
+)
+
+// batchOptions 批量模式参数；store 与 outDir 至少指定一个
+type batchOptions struct {
+	workers int
+	store   storage.Store
+	outDir  string // 每场写 <outDir>/<matchid>.json
+	report  string // 每个输入文件的处理结果写 <report>/<相对路径>.json，为空时只打到 stderr
+
+	allowPartial bool          // 截断/损坏的录像保留部分结果
+	heroSample   time.Duration // 英雄位置采样间隔，0 为不采样
+	catalog      *spot.Catalog // 不为 nil 时按常用眼位目录给眼位打 spot_id
+	sight        vision.Config // 采样时统计眼位看到的敌方英雄所用的视野半径
+}
+
+// batchResult 单个文件的处理结果
+type batchResult struct {
+	File    string  `json:"file"`
+	MatchID int64   `json:"match_id,omitempty"`
+	Wards   int     `json:"wards,omitempty"`
+	Skipped bool    `json:"skipped,omitempty"`
+	Partial bool    `json:"partial,omitempty"` // 录像截断/损坏，已保留部分结果，Error 为原因
+	Error   string  `json:"error,omitempty"`
+	Seconds float64 `json:"seconds,omitempty"`
+
+	replay *parser.Replay
+}
+
+// listReplays 展开目录（只取顶层录像文件）或 glob，结果按文件名排序
+func listReplays(pattern string) ([]string, error) {
+	var files []string
+	if fi, err := os.Stat(pattern); err == nil && fi.IsDir() {
+		entries, err := os.ReadDir(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if !e.IsDir() && isReplayName(e.Name()) {
+				files = append(files, filepath.Join(pattern, e.Name()))
+			}
+		}
+	} else {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			if isReplayName(m) {
+				files = append(files, m)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// replaySuffixes 批量模式识别的录像文件后缀；实际格式由 parser.Decompress 按内容判断
+var replaySuffixes = []string{".dem", ".dem.bz2", ".dem.gz", ".dem.zst"}
+
+func isReplayName(name string) bool {
+	for _, suf := range replaySuffixes {
+		if strings.HasSuffix(name, suf) {
+			return true
+		}
+	}
+	return false
+}
+
+// runBatch 用 opts.workers 个 worker 并发解析 files；写库与写报告在调用方 goroutine 串行进行。
+// 单个文件失败只记入报告，不中止整批。返回失败文件数。
+func runBatch(ctx context.Context, files []string, opts batchOptions) (int, error) {
+	if opts.report != "" {
+		if err := os.MkdirAll(opts.report, 0o755); err != nil {
+			return 0, err
+		}
+	}
+	if opts.outDir != "" {
+		if err := os.MkdirAll(opts.outDir, 0o755); err != nil {
+			return 0, err
+		}
+	}
+
+	jobs := make(chan string)
+	results := make(chan batchResult)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range jobs {
+				results <- parseFile(ctx, f, opts)
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, f := range files {
+			select {
+			case jobs <- f:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	root := commonDir(files)
+	var done, failed, skipped, partial, wards int
+	for res := range results {
+		done++
+		if (res.Error == "" || res.Partial) && !res.Skipped {
+			// 中止后仍写完已解析的结果，不用已取消的 ctx
+			if err := saveResult(context.Background(), &res, opts); err != nil {
+				res.Error = err.Error()
+				res.Partial = false
+			}
+		}
+		switch {
+		case res.Partial && res.Error != "":
+			partial++
+			wards += res.Wards
+			fmt.Fprintf(os.Stderr, "[%d/%d] 部分 %s: %d 条眼位，%s\n", done, len(files), res.File, res.Wards, res.Error)
+		case res.Error != "":
+			failed++
+			fmt.Fprintf(os.Stderr, "[%d/%d] 失败 %s: %s\n", done, len(files), res.File, res.Error)
+		case res.Skipped:
+			skipped++
+			fmt.Fprintf(os.Stderr, "[%d/%d] 跳过 %s (match_id=%d 已入库)\n", done, len(files), res.File, res.MatchID)
+		default:
+			wards += res.Wards
+			fmt.Fprintf(os.Stderr, "[%d/%d] %s: %d 条眼位 (%.1fs)\n", done, len(files), res.File, res.Wards, res.Seconds)
+		}
+		if opts.report != "" {
+			if err := writeReport(reportPath(opts.report, root, res.File), res); err != nil {
+				fmt.Fprintf(os.Stderr, "写入报告失败: %v\n", err)
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "完成: %d 个文件，成功 %d（其中部分 %d），跳过 %d，失败 %d，共 %d 条眼位\n",
+		len(files), done-failed-skipped, partial, skipped, failed, wards)
+	if missing := len(files) - done; missing > 0 {
+		fmt.Fprintf(os.Stderr, "已中止，%d 个文件未处理\n", missing)
+	}
+	return failed, ctx.Err()
+}
+
+// reportPath 输入文件 file 的报告路径：<dir>/<相对 root 的路径>.json，不同目录下的同名录像各有一份报告
+func reportPath(dir, root, file string) string {
+	rel, err := filepath.Rel(root, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		rel = filepath.Base(file)
+	}
+	return filepath.Join(dir, rel+".json")
+}
+
+// writeReport 写一个文件的报告，按需创建子目录
+func writeReport(out string, res batchResult) error {
+	if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+		return err
+	}
+	return writeJSON(out, res)
+}
+
+// commonDir files 共同的上级目录；目录模式下即该目录
+func commonDir(files []string) string {
+	if len(files) == 0 {
+		return "."
+	}
+	root := filepath.Dir(files[0])
+	for _, f := range files[1:] {
+		for dir := filepath.Dir(f); ; {
+			rel, err := filepath.Rel(root, dir)
+			if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				break
+			}
+			parent := filepath.Dir(root)
+			if parent == root {
+				break
+			}
+			root = parent
+		}
+	}
+	return root
+}
+
+// parseFile 推断 match_id、检查是否已入库并解析；不写库，写库由 saveResult 串行完成
+func parseFile(ctx context.Context, path string, opts batchOptions) batchResult {
+	res := batchResult{File: path}
+	// 先按文件名、再按录像末尾的 CDemoFileInfo 取 match_id，查是否已入库，省去解析；
+	// 都没有（如截断的录像）时解析后取 game rules 中的 match_id
+	id, ok := downloader.MatchIDFromName(path)
+	if !ok {
+		if v, err := parser.ReadMatchID(path); err == nil {
+			id, ok = v, true
+		}
+	}
+	if ok {
+		res.MatchID = id
+		if done, err := alreadyIngested(ctx, id, opts); err != nil {
+			res.Error = err.Error()
+			return res
+		} else if done {
+			res.Skipped = true
+			return res
+		}
+	}
+	start := time.Now()
+	x := parser.NewWardExtractor(res.MatchID)
+	x.HeroSampleSec = opts.heroSample.Seconds()
+	replay, err := x.RunFile(context.Background(), path) // Ctrl+C 时已开始的文件解析完再退出
+	res.Seconds = time.Since(start).Seconds()
+	if err != nil {
+		res.Error = err.Error()
+		var partial *parser.PartialError
+		if !opts.allowPartial || !errors.As(err, &partial) {
+			return res
+		}
+		res.Partial = true
+	}
+	if res.MatchID == 0 {
+		if res.MatchID = replay.Info.MatchID; res.MatchID == 0 {
+			res.Error = "文件名与录像中都没有 match_id"
+			res.Partial = false
+			return res
+		}
+	}
+	replay.Info.MatchID = res.MatchID
+	if opts.heroSample > 0 {
+		vision.Spotted(replay.Wards, replay.Tracks, vision.NewTimeline(replay.Vision), opts.sight)
+	}
+	if opts.catalog != nil {
+		opts.catalog.AssignRecords(replay.Wards, spot.PatchBounds(map[int64]string{res.MatchID: replay.Info.Patch}))
+	}
+	res.replay = replay
+	res.Wards = len(replay.Wards)
+	return res
+}
+
+// alreadyIngested 该场是否已完整入库；只保存了部分结果的比赛（截断/损坏录像）不算，会重新解析并替换
+func alreadyIngested(ctx context.Context, matchID int64, opts batchOptions) (bool, error) {
+	if opts.store != nil {
+		return opts.store.HasMatch(ctx, matchID)
+	}
+	_, err := os.Stat(filepath.Join(opts.outDir, fmt.Sprintf("%d.json", matchID)))
+	return err == nil, nil
+}
+
+func saveResult(ctx context.Context, res *batchResult, opts batchOptions) error {
+	if opts.store != nil {
+		m := storage.MatchFromInfo(res.replay.Info)
+		m.Partial = res.Partial
+		r := storage.Replay{Wards: res.replay.Wards, Vision: res.replay.Vision, Trees: res.replay.Trees}
+		if opts.heroSample > 0 {
+			r.Tracks = res.replay.Tracks
+		}
+		return opts.store.SaveReplay(ctx, m, r)
+	}
+	// 元数据与视野事件先写：<matchid>.json 存在即视为已完成。部分结果的眼位写 <matchid>.partial.json，
+	// 下次仍会解析，完整结果写入后删除
+	base := filepath.Join(opts.outDir, fmt.Sprint(res.MatchID))
+	if err := writeJSON(base+".match.json", res.replay.Info); err != nil {
+		return err
+	}
+	if err := writeJSON(base+".vision.json", res.replay.Vision); err != nil {
+		return err
+	}
+	if err := writeJSON(base+".trees.json", res.replay.Trees); err != nil {
+		return err
+	}
+	if opts.heroSample > 0 {
+		if err := writeJSON(base+".tracks.json", res.replay.Tracks); err != nil {
+			return err
+		}
+	}
+	if res.Partial {
+		return writeJSON(base+".partial.json", res.replay.Wards)
+	}
+	if err := writeJSON(base+".json", res.replay.Wards); err != nil {
+		return err
+	}
+	if err := os.Remove(base + ".partial.json"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// writeJSON 先写临时文件再改名，避免中断后留下半个 JSON 被当作已完成
+func writeJSON(out string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := out + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, out)
+}
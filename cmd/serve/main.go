@@ -1,37 +1,88 @@
 // 本地 HTTP 服务：提供战队列表、战队最近 30 场比赛等 API，供前端调用。
-// 用法: go run ./cmd/serve
+// 用法: go run ./cmd/serve [-store sqlite|postgres -dsn <path 或连接串>] [-spots spots.json] [-replays replays]
 // API: GET /api/teams        -> 战队列表
 //
 //	GET /api/teams/:id/matches?limit=30 -> 战队最近 N 场比赛
+//	GET /api/teams/:id/aggregate?last=20&since=&until=&normalize_side= -> 战队多场眼位汇总（默认夜魇方对称到左下）
+//	GET /api/teams/:id/predict?side=2&minutes=10-20&roshan=up -> 预测该队在各常用眼位插眼的概率（需 -store）
+//	GET /api/heatmap?match_id=  -> 单场眼位（已入库优先，否则取 OpenDota）
+//	GET /api/wards/near?x=&y=&radius= 或 ?region=roshan&radius= -> 库中某点或某区域附近的眼位（需 -store）
+//	GET /api/parse?match_id=    -> 流式解析本地录像（SSE，需 -replays），关闭页面即中止
 package main
 
 import (
+	"context"
 	"embed"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/cndotaplan/cndotaplan/internal/analytics"
+	"github.com/cndotaplan/cndotaplan/internal/coord"
 	"github.com/cndotaplan/cndotaplan/internal/model"
+	"github.com/cndotaplan/cndotaplan/internal/region"
+	"github.com/cndotaplan/cndotaplan/internal/spot"
+	"github.com/cndotaplan/cndotaplan/internal/storage"
+	"github.com/cndotaplan/cndotaplan/internal/terrain"
+	"github.com/cndotaplan/cndotaplan/internal/vision"
 )
 
-//go:embed index.html matches.html heatmap.html
+//go:embed index.html matches.html heatmap.html aggregate.html
 var indexFS embed.FS
 
 const openDotaBase = "https://api.opendota.com/api"
 
+// regions 区域表，OpenDota 眼位坐标即网格单位，可直接打标
+var regions *region.Map
+
+// grid 地形格子，用于计算眼位被高地与树遮挡后的可见区域；未指定 -terrain 时为 nil，不返回可见区域
+var grid *terrain.Grid
+
 func main() {
+	storeDriver := flag.String("store", "", "眼位库后端：sqlite 或 postgres（可选）")
+	storeDSN := flag.String("dsn", "", "眼位库：SQLite 文件路径或 PostgreSQL 连接串")
+	flag.StringVar(&replayDir, "replays", "", "本地录像目录（cmd/fetch 的 -dir），用于 /api/parse")
+	spotsPath := flag.String("spots", "", "常用眼位目录（cmd/spots 生成，可选）；不指定时预测按该队的眼位现场聚类；指定后 /api/parse 入库的眼位按此打 spot_id")
+	terrainPath := flag.String("terrain", "", "地形格子文件（cmd/terrain 从地图导出，可选）；不指定时视野只按半径画圆，不计算高地与树的遮挡")
+	flag.Parse()
+
+	var err error
+	if regions, err = region.Load(""); err != nil {
+		log.Fatalf("加载区域数据: %v", err)
+	}
+	if *terrainPath == "" {
+		log.Print("未指定 -terrain：不计算眼位视野的地形遮挡")
+	} else if grid, err = terrain.Open(*terrainPath, regions.Patch); err != nil {
+		log.Fatalf("加载地形数据: %v", err)
+	}
+	if *storeDSN != "" {
+		if store, err = storage.Open(*storeDriver, *storeDSN); err != nil {
+			log.Fatalf("打开眼位库: %v", err)
+		}
+		defer store.Close()
+	}
+	if *spotsPath != "" {
+		if spots, err = spot.LoadCatalog(*spotsPath); err != nil {
+			log.Fatalf("加载眼位目录: %v", err)
+		}
+	}
 	mux := http.NewServeMux()
 	mux.HandleFunc("/api/teams", handleTeams)
 	mux.HandleFunc("/api/teams/", handleTeamMatches)
-	mux.HandleFunc("/teams/", handleTeamMatchesPage)
+	mux.HandleFunc("/teams/", handleTeamPage)
 	mux.HandleFunc("/heatmap", handleHeatmap)
 	mux.HandleFunc("/api/heatmap", handleHeatmapAPI)
 	mux.HandleFunc("/api/map-image", handleMapImage)
+	mux.HandleFunc("/api/wards/near", handleWardsNear)
+	mux.HandleFunc("/api/parse", handleParse)
 	mux.HandleFunc("/", handleIndex)
 	addr := "127.0.0.1:8082"
 	log.Printf("启动服务 http://%s  （仅本机访问）", addr)
@@ -49,10 +100,10 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
-func handleTeamMatchesPage(w http.ResponseWriter, r *http.Request) {
+func handleTeamPage(w http.ResponseWriter, r *http.Request) {
 	path := strings.Trim(r.URL.Path, "/")
 	parts := strings.Split(path, "/")
-	if len(parts) != 3 || parts[0] != "teams" || parts[2] != "matches" {
+	if len(parts) != 3 || parts[0] != "teams" || (parts[2] != "matches" && parts[2] != "aggregate") {
 		http.NotFound(w, r)
 		return
 	}
@@ -60,7 +111,7 @@ func handleTeamMatchesPage(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
-	data, _ := indexFS.ReadFile("matches.html")
+	data, _ := indexFS.ReadFile(parts[2] + ".html")
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.Write(data)
 }
@@ -113,6 +164,14 @@ func handleTeamMatches(w http.ResponseWriter, r *http.Request) {
 		io.Copy(w, resp.Body)
 		return
 	}
+	if len(parts) == 4 && parts[3] == "aggregate" {
+		handleTeamAggregate(w, r, int64(teamID))
+		return
+	}
+	if len(parts) == 4 && parts[3] == "predict" {
+		handleTeamPredict(w, r, int64(teamID))
+		return
+	}
 	if len(parts) != 4 || parts[3] != "matches" {
 		http.NotFound(w, r)
 		return
@@ -191,7 +250,10 @@ func handleHeatmapAPI(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid match_id", 400)
 		return
 	}
-	payload, err := fetchOpenDotaVision(matchID)
+	payload, err := storedVision(r, matchID)
+	if err == nil && payload == nil {
+		payload, err = fetchOpenDotaVision(r.Context(), matchID)
+	}
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
@@ -201,24 +263,143 @@ func handleHeatmapAPI(w http.ResponseWriter, r *http.Request) {
 }
 
 type heatmapPayload struct {
-	DurationSec int                 `json:"duration_sec"`
-	Wards       []model.WardRecord  `json:"wards"`
+	DurationSec int                `json:"duration_sec"`
+	Wards       []model.WardRecord `json:"wards"`
+	// Vision 雾、粉、宝石、哨塔、扫描等事件，仅本地解析的比赛有（OpenDota 不提供位置）
+	Vision    []model.VisionEvent `json:"vision,omitempty"`
+	MapBounds mapBounds           `json:"map_bounds"` // 底图覆盖范围，单位与 wards 的 coord_space 一致
+	// WardRadii 与 Wards 一一对应：该眼存活期间按昼夜（含黑暗飞升等临时夜晚）与附近砍树分段的视野半径
+	// 与可见区域，单位同坐标
+	WardRadii [][]vision.Window `json:"ward_radii"`
+	// Trees 砍树与临时树（坐标与半径为网格单位），仅本地解析的比赛有
+	Trees []model.TreeEvent `json:"trees,omitempty"`
 }
 
-func fetchOpenDotaVision(matchID int64) (*heatmapPayload, error) {
-	url := fmt.Sprintf("%s/matches/%d", openDotaBase, matchID)
-	req, _ := http.NewRequest(http.MethodGet, url, nil)
+// newHeatmapPayload wards 与 events 已换算为 OpenDota 网格，trees 为录像世界坐标
+func newHeatmapPayload(durationSec int, wards []model.WardRecord, events []model.VisionEvent, trees []model.TreeEvent) *heatmapPayload {
+	p := &heatmapPayload{
+		DurationSec: durationSec,
+		Wards:       wards,
+		Vision:      events,
+		MapBounds:   gridBounds(regions.Patch),
+		WardRadii:   wardRadii(wards, events, trees),
+		Trees:       trees,
+	}
+	treesToGrid(trees)
+	return p
+}
+
+// treesToGrid 把树变化的坐标与半径换算为 OpenDota 网格
+func treesToGrid(trees []model.TreeEvent) {
+	b := coord.BoundsFor(regions.Patch)
+	for i := range trees {
+		t := &trees[i]
+		space := coord.Space(t.CoordSpace)
+		if space == "" {
+			space = coord.World
+		}
+		t.PosX, t.PosY = b.Convert(t.PosX, t.PosY, space, coord.Grid)
+		if space != coord.Grid {
+			t.Radius /= coord.GridUnit
+		}
+		t.CoordSpace = string(coord.Grid)
+	}
+}
+
+// wardRadii 按 vision.Default 计算每个眼的半径分段与地形遮挡后的可见区域，并换算为网格单位；
+// 没有时长的眼（OpenDota 缺 left_log）按该类型最大存活时间
+func wardRadii(wards []model.WardRecord, events []model.VisionEvent, trees []model.TreeEvent) [][]vision.Window {
+	tl := vision.NewTimeline(events)
+	out := make([][]vision.Window, len(wards))
+	for i := range wards {
+		w := wards[i]
+		if w.DurationSec <= 0 {
+			w.DurationSec = w.MaxDurationSec()
+		}
+		ws := tl.WardWindows(&w, vision.Default)
+		if grid != nil && (w.PosX != 0 || w.PosY != 0) {
+			wx, wy := coord.GridToWorld(w.PosX, w.PosY)
+			ws = vision.WithTerrain(ws, grid, trees, wx, wy)
+		}
+		for j := range ws {
+			ws[j].Radius /= coord.GridUnit
+			for k, p := range ws[j].Polygon {
+				// 保留一位小数（约 13 世界单位），控制响应体积
+				gx, gy := coord.WorldToGrid(p[0], p[1])
+				ws[j].Polygon[k] = terrain.Point{math.Round(gx*10) / 10, math.Round(gy*10) / 10}
+			}
+		}
+		out[i] = ws
+	}
+	return out
+}
+
+// mapBounds 底图边界（OpenDota 网格）
+type mapBounds struct {
+	MinX float64 `json:"min_x"`
+	MinY float64 `json:"min_y"`
+	MaxX float64 `json:"max_x"`
+	MaxY float64 `json:"max_y"`
+}
+
+func gridBounds(patch string) mapBounds {
+	b := coord.BoundsFor(patch)
+	minX, minY := coord.WorldToGrid(b.MinX, b.MinY)
+	maxX, maxY := coord.WorldToGrid(b.MaxX, b.MaxY)
+	return mapBounds{MinX: minX, MinY: minY, MaxX: maxX, MaxY: maxY}
+}
+
+func fetchOpenDotaVision(ctx context.Context, matchID int64) (*heatmapPayload, error) {
+	m, err := fetchOpenDotaMatch(ctx, matchID)
+	if err != nil {
+		return nil, err
+	}
+	return newHeatmapPayload(m.DurationSec, m.Wards, nil, nil), nil
+}
+
+// openDotaMatch OpenDota 比赛数据中用到的部分：眼位（网格坐标）、时长与双方职业战队
+type openDotaMatch struct {
+	DurationSec int
+	Wards       []model.WardRecord
+	Sides       analytics.Sides
+}
+
+// openDotaGet 以 ctx 请求 OpenDota API 的 path，非 200 时返回错误；调用方负责关闭 Body
+func openDotaGet(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, openDotaBase+path, nil)
+	if err != nil {
+		return nil, err
+	}
 	req.Header.Set("User-Agent", "CnDotaPlan/1.0")
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("opendota: %s: %s", path, resp.Status)
+	}
+	return resp, nil
+}
+
+func fetchOpenDotaMatch(ctx context.Context, matchID int64) (*openDotaMatch, error) {
+	resp, err := openDotaGet(ctx, fmt.Sprintf("/matches/%d", matchID))
+	if err != nil {
+		return nil, err
+	}
 	defer resp.Body.Close()
 	var data struct {
-		Duration int `json:"duration"`
-		Players  []struct {
-			PlayerSlot int `json:"player_slot"`
-			ObsLog     []struct {
+		Duration      int   `json:"duration"`
+		StartTime     int64 `json:"start_time"`
+		RadiantTeamID int64 `json:"radiant_team_id"`
+		DireTeamID    int64 `json:"dire_team_id"`
+		Players       []struct {
+			PlayerSlot  int    `json:"player_slot"`
+			AccountID   uint32 `json:"account_id"`
+			Personaname string `json:"personaname"`
+			Name        string `json:"name"` // 职业选手登记名，优先于 personaname
+			HeroID      int32  `json:"hero_id"`
+			ObsLog      []struct {
 				X float64 `json:"x"`
 				Y float64 `json:"y"`
 				T float64 `json:"time"`
@@ -242,32 +423,50 @@ func fetchOpenDotaVision(matchID int64) (*heatmapPayload, error) {
 		if p.PlayerSlot >= 128 {
 			teamID = 3
 		}
+		playerName := p.Name
+		if playerName == "" {
+			playerName = p.Personaname
+		}
 		for _, e := range p.ObsLog {
 			records = append(records, model.WardRecord{
-				MatchID:      matchID,
-				TeamID:       teamID,
-				WardType:     "observer",
-				PosX:         e.X,
-				PosY:         e.Y,
-				GameTimeSec:  e.T,
-				DurationSec:  0,
-				IsDenied:     false,
-				RegionTag:    "",
+				MatchID:     matchID,
+				TeamID:      teamID,
+				WardType:    "observer",
+				PlayerSlot:  int32(p.PlayerSlot),
+				AccountID:   p.AccountID,
+				PlayerName:  playerName,
+				HeroID:      p.HeroID,
+				PosX:        e.X,
+				PosY:        e.Y,
+				CoordSpace:  string(coord.Grid),
+				GameTimeSec: e.T,
+				DurationSec: 0,
+				IsDenied:    false,
+				RegionTag:   regions.Tag(e.X, e.Y),
 			})
 		}
 		for _, e := range p.SenLog {
 			records = append(records, model.WardRecord{
-				MatchID:      matchID,
-				TeamID:       teamID,
-				WardType:     "sentry",
-				PosX:         e.X,
-				PosY:         e.Y,
-				GameTimeSec:  e.T,
-				DurationSec:  0,
-				IsDenied:     false,
-				RegionTag:    "",
+				MatchID:     matchID,
+				TeamID:      teamID,
+				WardType:    "sentry",
+				PlayerSlot:  int32(p.PlayerSlot),
+				AccountID:   p.AccountID,
+				PlayerName:  playerName,
+				HeroID:      p.HeroID,
+				PosX:        e.X,
+				PosY:        e.Y,
+				CoordSpace:  string(coord.Grid),
+				GameTimeSec: e.T,
+				DurationSec: 0,
+				IsDenied:    false,
+				RegionTag:   regions.Tag(e.X, e.Y),
 			})
 		}
 	}
-	return &heatmapPayload{DurationSec: data.Duration, Wards: records}, nil
+	sides := analytics.Sides{MatchID: matchID, Radiant: data.RadiantTeamID, Dire: data.DireTeamID}
+	if data.StartTime > 0 {
+		sides.StartTime = time.Unix(data.StartTime, 0).UTC()
+	}
+	return &openDotaMatch{DurationSec: data.Duration, Wards: records, Sides: sides}, nil
 }
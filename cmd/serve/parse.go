@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/cndotaplan/cndotaplan/internal/coord"
+	"github.com/cndotaplan/cndotaplan/internal/downloader"
+	"github.com/cndotaplan/cndotaplan/internal/parser"
+	"github.com/cndotaplan/cndotaplan/internal/spot"
+	"github.com/cndotaplan/cndotaplan/internal/storage"
+)
+
+// replayDir 本地录像目录（-replays 指定，布局见 internal/downloader）；为空时不提供 /api/parse
+var replayDir string
+
+// parseProgress /api/parse 的 progress 事件
+type parseProgress struct {
+	parser.Progress
+	BytesRead  int64 `json:"bytes_read"`
+	BytesTotal int64 `json:"bytes_total"`
+}
+
+// handleParse GET /api/parse?match_id= 以 Server-Sent Events 流式解析本地录像：
+// progress（parseProgress）、ward（parser.WardEvent，坐标为 OpenDota 网格）、done（heatmapPayload）、failed（错误信息）。
+// 录像截断或损坏时先发 partial，（错误信息），再以已解析部分发 done。
+// 客户端断开（关闭页面）即中止解析；配置了 -store 时解析结果写入库。
+func handleParse(w http.ResponseWriter, r *http.Request) {
+	if replayDir == "" {
+		http.Error(w, "replay dir not configured (start with -replays)", http.StatusNotImplemented)
+		return
+	}
+	matchID, err := strconv.ParseInt(r.URL.Query().Get("match_id"), 10, 64)
+	if err != nil || matchID <= 0 {
+		http.Error(w, "invalid match_id", 400)
+		return
+	}
+	path := downloader.New(replayDir).Existing(matchID)
+	if path == "" {
+		http.Error(w, fmt.Sprintf("replay for %d not found in %s", matchID, replayDir), http.StatusNotFound)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", 500)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	defer f.Close()
+	var total int64
+	if fi, err := f.Stat(); err == nil {
+		total = fi.Size()
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	send := func(event string, v interface{}) {
+		data, _ := json.Marshal(v)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+		flusher.Flush()
+	}
+
+	counter := &countingReader{r: f}
+	bounds := coord.BoundsFor(regions.Patch)
+	x := parser.NewWardExtractor(matchID)
+	x.OnProgress = func(p parser.Progress) {
+		send("progress", parseProgress{Progress: p, BytesRead: counter.n, BytesTotal: total})
+	}
+	x.OnEvent = func(ev parser.WardEvent) {
+		ev.Ward.PosX, ev.Ward.PosY = bounds.Convert(ev.Ward.PosX, ev.Ward.PosY, coord.World, coord.Grid)
+		ev.Ward.CoordSpace = string(coord.Grid)
+		send("ward", ev)
+	}
+	records, err := x.Run(r.Context(), counter)
+	if r.Context().Err() != nil {
+		log.Printf("解析 %d 已中止（客户端断开）", matchID)
+		return
+	}
+	var partial *parser.PartialError
+	if errors.As(err, &partial) {
+		// 录像截断/损坏：保留已解析部分，前端提示
+		send("partial", partial.Error())
+	} else if err != nil {
+		send("failed", err.Error())
+		return
+	}
+	if spots != nil {
+		spots.AssignRecords(records, spot.PatchBounds(map[int64]string{x.Info.MatchID: x.Info.Patch}))
+	}
+	if store != nil {
+		m := storage.MatchFromInfo(x.Info)
+		m.Partial = partial != nil
+		if err := store.SaveReplay(r.Context(), m, storage.Replay{Wards: records, Vision: x.Vision, Trees: x.Trees}); err != nil {
+			send("failed", err.Error())
+			return
+		}
+	}
+	bounds = coord.BoundsFor(x.Info.Patch)
+	bounds.ConvertRecords(records, coord.Grid)
+	visionToGrid(bounds, x.Vision)
+	send("done", newHeatmapPayload(matchDuration(records), records, x.Vision, x.Trees))
+}
+
+// countingReader 统计已读取的字节数（压缩前），用于按文件大小估算进度
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
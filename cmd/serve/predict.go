@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cndotaplan/cndotaplan/internal/coord"
+	"github.com/cndotaplan/cndotaplan/internal/model"
+	"github.com/cndotaplan/cndotaplan/internal/predict"
+	"github.com/cndotaplan/cndotaplan/internal/spot"
+	"github.com/cndotaplan/cndotaplan/internal/storage"
+)
+
+// 预测默认/最多取该队最近多少场
+const (
+	defaultPredictMatches = 30
+	maxPredictMatches     = 100
+)
+
+// spots 常用眼位目录（-spots 指定，cmd/spots 生成）；为空时按该队的眼位现场聚类
+var spots *spot.Catalog
+
+// predictResponse GET /api/teams/:id/predict 的响应，坐标与半径为 OpenDota 网格
+type predictResponse struct {
+	TeamID int64 `json:"team_id"`
+	// Catalog spots：-spots 目录；clustered：目录为空时按该队这些场次的眼位现场聚类
+	Catalog string `json:"catalog"`
+	Matches int    `json:"matches"`
+	predict.Result
+	MapBounds mapBounds `json:"map_bounds"`
+}
+
+// handleTeamPredict GET /api/teams/:id/predict?side=2&minutes=10-20[&roshan=up|down&ward_type=observer&top=10&last=30]
+// 按库中该队最近 last 场的眼位预测其在 side 阵营、插眼时间窗 minutes（分钟）与肉山状态下插在各常用眼位的概率
+// （internal/predict）。只用库中录像解析的数据（肉山状态只来自录像），需 -store。
+func handleTeamPredict(w http.ResponseWriter, r *http.Request, teamID int64) {
+	if store == nil {
+		http.Error(w, "store not configured (start with -store/-dsn)", http.StatusNotImplemented)
+		return
+	}
+	q := r.URL.Query()
+	var pq predict.Query
+	switch v := q.Get("side"); v {
+	case "", "0":
+	case "2", "radiant":
+		pq.Side = 2
+	case "3", "dire":
+		pq.Side = 3
+	default:
+		http.Error(w, "side must be 2 (radiant) or 3 (dire)", 400)
+		return
+	}
+	var err error
+	if pq.FromMin, pq.ToMin, err = parseMinuteRange(q.Get("minutes")); err != nil {
+		http.Error(w, "minutes must look like 10-20 or 30-", 400)
+		return
+	}
+	switch pq.Roshan = q.Get("roshan"); pq.Roshan {
+	case "", model.RoshanUp, model.RoshanDown:
+	default:
+		http.Error(w, "roshan must be up or down", 400)
+		return
+	}
+	pq.WardType = q.Get("ward_type")
+	top := 10
+	if n, err := strconv.Atoi(q.Get("top")); err == nil {
+		top = n
+	}
+	last := defaultPredictMatches
+	if n, err := strconv.Atoi(q.Get("last")); err == nil && n > 0 {
+		last = n
+	}
+	if last > maxPredictMatches {
+		last = maxPredictMatches
+	}
+
+	wards, err := store.Wards(r.Context(), storage.WardFilter{ProTeamID: teamID, LastMatches: last})
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	matches := matchesOf(wards)
+	ids := make([]int64, len(matches))
+	for i, m := range matches {
+		ids[i] = m.MatchID
+	}
+	patches, err := store.MatchPatches(r.Context(), ids)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	bounds := spot.PatchBounds(patches)
+	resp := &predictResponse{TeamID: teamID, Catalog: "spots", Matches: len(matches), MapBounds: gridBounds(regions.Patch)}
+	catalog := spots
+	if catalog == nil || len(catalog.Spots) == 0 {
+		resp.Catalog = "clustered"
+		catalog = &spot.Catalog{Spots: spot.Cluster(wards, bounds, spot.DefaultOptions)}
+	}
+	// 按当前目录重新归类，库中的 spot_id 可能来自旧目录
+	catalog.AssignRecords(wards, bounds)
+	resp.Result = predict.Predict(wards, catalog, pq, predict.DefaultOptions, top)
+	for i := range resp.Spots {
+		p := &resp.Spots[i]
+		p.X, p.Y = coord.WorldToGrid(p.X, p.Y)
+		p.Radius /= coord.GridUnit
+	}
+	if resp.Spots == nil {
+		resp.Spots = []predict.Prediction{}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// parseMinuteRange 解析 "10-20" 或 "30-"（分钟），空串不限；上界不限时为 0（predict.Query 的约定）
+func parseMinuteRange(s string) (float64, float64, error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	lo, hi, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, strconv.ErrSyntax
+	}
+	from, err := strconv.ParseFloat(lo, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	if hi == "" {
+		return from, 0, nil
+	}
+	to, err := strconv.ParseFloat(hi, 64)
+	if err != nil || to <= from || math.IsInf(to, 0) {
+		return 0, 0, strconv.ErrSyntax
+	}
+	return from, to, nil
+}
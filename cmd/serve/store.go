@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/cndotaplan/cndotaplan/internal/coord"
+	"github.com/cndotaplan/cndotaplan/internal/model"
+	"github.com/cndotaplan/cndotaplan/internal/storage"
+)
+
+// store 可选的眼位库（-store/-dsn 指定）；为 nil 时所有数据都直接取自 OpenDota
+var store storage.Store
+
+// storedVision 从库中读取已解析的比赛；未入库或只有部分结果时返回 nil, nil，由调用方回退到 OpenDota
+func storedVision(r *http.Request, matchID int64) (*heatmapPayload, error) {
+	if store == nil {
+		return nil, nil
+	}
+	ok, err := store.HasMatch(r.Context(), matchID)
+	if err != nil || !ok {
+		return nil, err
+	}
+	wards, err := store.Wards(r.Context(), storage.WardFilter{MatchIDs: []int64{matchID}})
+	if err != nil {
+		return nil, err
+	}
+	vision, err := store.Vision(r.Context(), matchID)
+	if err != nil {
+		return nil, err
+	}
+	trees, err := store.Trees(r.Context(), matchID)
+	if err != nil {
+		return nil, err
+	}
+	patches, err := store.MatchPatches(r.Context(), []int64{matchID})
+	if err != nil {
+		return nil, err
+	}
+	// 前端按 OpenDota 网格绘制，按该场的版本边界换算
+	b := coord.BoundsFor(patches[matchID])
+	b.ConvertRecords(wards, coord.Grid)
+	visionToGrid(b, vision)
+	return newHeatmapPayload(matchDuration(wards), wards, vision, trees), nil
+}
+
+// wardsToGrid 按各场的版本（matches.patch）的地图边界把眼位换算为 OpenDota 网格；records 按 match_id 排序
+func wardsToGrid(ctx context.Context, records []model.WardRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	var ids []int64
+	for _, m := range matchesOf(records) {
+		ids = append(ids, m.MatchID)
+	}
+	patches, err := store.MatchPatches(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(records); {
+		j := i + 1
+		for j < len(records) && records[j].MatchID == records[i].MatchID {
+			j++
+		}
+		coord.BoundsFor(patches[records[i].MatchID]).ConvertRecords(records[i:j], coord.Grid)
+		i = j
+	}
+	return nil
+}
+
+// visionToGrid 按 b 把视野事件坐标换算为 OpenDota 网格
+func visionToGrid(b coord.Bounds, events []model.VisionEvent) {
+	for i := range events {
+		ev := &events[i]
+		space := coord.Space(ev.CoordSpace)
+		if space == "" {
+			space = coord.World
+		}
+		ev.PosX, ev.PosY = b.Convert(ev.PosX, ev.PosY, space, coord.Grid)
+		ev.CoordSpace = string(coord.Grid)
+	}
+}
+
+// matchDuration 由眼位推算比赛时长（最后一只眼的结束时刻），没有眼位时按 60 分钟
+func matchDuration(wards []model.WardRecord) int {
+	duration := 0.0
+	for _, w := range wards {
+		duration = math.Max(duration, w.GameTimeSec+w.DurationSec)
+	}
+	if duration <= 0 {
+		duration = 3600
+	}
+	return int(duration)
+}
+
+// handleWardsNear GET /api/wards/near?x=&y=&radius=[&ward_type=&team_id=&match_id=]
+// 或 /api/wards/near?region=roshan&radius=600[&patch=7.40&...]
+// x、y、radius 为世界坐标单位；返回库中该点（或该区域多边形）radius 以内的眼位
+func handleWardsNear(w http.ResponseWriter, r *http.Request) {
+	if store == nil {
+		http.Error(w, "store not configured (start with -store/-dsn)", http.StatusNotImplemented)
+		return
+	}
+	q := r.URL.Query()
+	radius, errR := strconv.ParseFloat(q.Get("radius"), 64)
+	if errR != nil || radius <= 0 {
+		http.Error(w, "radius required", 400)
+		return
+	}
+	f := storage.WardFilter{WardType: q.Get("ward_type")}
+	if t, err := strconv.Atoi(q.Get("team_id")); err == nil {
+		f.TeamID = int32(t)
+	}
+	if id, err := strconv.ParseInt(q.Get("match_id"), 10, 64); err == nil {
+		f.MatchIDs = []int64{id}
+	}
+	var wards []model.WardRecord
+	var err error
+	if tag := q.Get("region"); tag != "" {
+		wards, err = store.WardsNearRegion(r.Context(), q.Get("patch"), tag, radius, f)
+	} else {
+		x, errX := strconv.ParseFloat(q.Get("x"), 64)
+		y, errY := strconv.ParseFloat(q.Get("y"), 64)
+		if errX != nil || errY != nil {
+			http.Error(w, "x, y (or region) required", 400)
+			return
+		}
+		wards, err = store.WardsWithin(r.Context(), x, y, radius, f)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if wards == nil {
+		wards = []model.WardRecord{}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(wards)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cndotaplan/cndotaplan/internal/analytics"
+	"github.com/cndotaplan/cndotaplan/internal/model"
+	"github.com/cndotaplan/cndotaplan/internal/storage"
+)
+
+// 战队汇总默认/最多取的场数；OpenDota 回退时每场一次请求
+const (
+	defaultAggregateMatches = 20
+	maxAggregateMatches     = 50
+)
+
+// teamAggregate GET /api/teams/:id/aggregate 的响应
+type teamAggregate struct {
+	TeamID int64  `json:"team_id"`
+	Source string `json:"source"` // store：库中已解析的比赛；opendota：库中没有时取 OpenDota
+	// Matches 参与汇总的比赛，Side 为该队当场的阵营（2=天辉 3=夜魇）
+	Matches []teamMatch `json:"matches"`
+	// Skipped OpenDota 请求失败的比赛
+	Skipped []int64 `json:"skipped,omitempty"`
+	// Wards 该队的眼位（OpenDota 网格）；normalize_side 时夜魇方的已按地图中心对称到左下，team_id 统一为 2
+	Wards     []model.WardRecord `json:"wards"`
+	MapBounds mapBounds          `json:"map_bounds"`
+	Rows      []analytics.Row    `json:"rows"`
+}
+
+type teamMatch struct {
+	MatchID   int64 `json:"match_id"`
+	Side      int32 `json:"side"`
+	StartTime int64 `json:"start_time,omitempty"` // Unix 秒，未知为 0
+	Wards     int   `json:"wards"`
+}
+
+// handleTeamAggregate GET /api/teams/:id/aggregate?last=20[&since=YYYY-MM-DD&until=YYYY-MM-DD&phases=15,30&normalize_side=0]
+// 汇总职业战队最近 last 场（或日期范围内）的眼位与 internal/analytics 统计。阵营 → 战队优先取库中
+// matches 表（录像元数据），库中没有该队的比赛时取 OpenDota 比赛数据的 radiant_team_id / dire_team_id。
+// normalize_side 默认开启（analytics.NormalizeSide）；为 0 时保留原位置，统计按天辉/夜魇分开，便于比较两边的打法。
+func handleTeamAggregate(w http.ResponseWriter, r *http.Request, teamID int64) {
+	q := r.URL.Query()
+	last := defaultAggregateMatches
+	if n, err := strconv.Atoi(q.Get("last")); err == nil && n > 0 {
+		last = n
+	}
+	if last > maxAggregateMatches {
+		last = maxAggregateMatches
+	}
+	since, errS := parseDay(q.Get("since"))
+	until, errU := parseDay(q.Get("until"))
+	if errS != nil || errU != nil {
+		http.Error(w, "since/until must be YYYY-MM-DD", 400)
+		return
+	}
+	phases, err := analytics.ParsePhases(q.Get("phases"))
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	normalize := true
+	if v := q.Get("normalize_side"); v != "" {
+		if normalize, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "invalid normalize_side", 400)
+			return
+		}
+	}
+
+	agg := &teamAggregate{TeamID: teamID, Source: "store"}
+	if store != nil {
+		wards, err := store.Wards(r.Context(), storage.WardFilter{ProTeamID: teamID, Since: since, Until: until, LastMatches: last})
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		if err := wardsToGrid(r.Context(), wards); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		agg.Wards = wards
+		agg.Matches = matchesOf(wards)
+	}
+	if len(agg.Wards) == 0 {
+		agg.Source = "opendota"
+		if err := openDotaTeamWards(r.Context(), agg, since, until, last); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	}
+	if normalize {
+		analytics.NormalizeSide(agg.Wards, regions)
+	}
+	if agg.Wards == nil {
+		agg.Wards = []model.WardRecord{}
+	}
+	agg.MapBounds = gridBounds(regions.Patch)
+	agg.Rows = analytics.Aggregate(agg.Wards, analytics.Options{Phases: phases})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(agg)
+}
+
+// matchesOf 按眼位列出比赛与该队阵营（records 已只含该队的眼位，按 match_id 排序）
+func matchesOf(records []model.WardRecord) []teamMatch {
+	var out []teamMatch
+	for _, w := range records {
+		if n := len(out); n > 0 && out[n-1].MatchID == w.MatchID {
+			out[n-1].Wards++
+			continue
+		}
+		out = append(out, teamMatch{MatchID: w.MatchID, Side: w.TeamID, Wards: 1})
+	}
+	return out
+}
+
+// openDotaTeamWards 从 OpenDota 战队比赛列表选出比赛，逐场取眼位并只保留该队一方
+func openDotaTeamWards(ctx context.Context, agg *teamAggregate, since, until time.Time, last int) error {
+	resp, err := openDotaGet(ctx, fmt.Sprintf("/teams/%d/matches", agg.TeamID))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var list []struct {
+		MatchID   int64 `json:"match_id"`
+		Radiant   bool  `json:"radiant"`
+		StartTime int64 `json:"start_time"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return fmt.Errorf("opendota: team %d matches: %w", agg.TeamID, err)
+	}
+	var listed []analytics.Sides
+	for _, m := range list {
+		s := analytics.Sides{MatchID: m.MatchID, Dire: agg.TeamID}
+		if m.Radiant {
+			s = analytics.Sides{MatchID: m.MatchID, Radiant: agg.TeamID}
+		}
+		if m.StartTime > 0 {
+			s.StartTime = time.Unix(m.StartTime, 0).UTC()
+		}
+		listed = append(listed, s)
+	}
+	for _, s := range analytics.TeamMatches(listed, agg.TeamID, since, until, last) {
+		m, err := fetchOpenDotaMatch(ctx, s.MatchID)
+		if err != nil {
+			log.Printf("战队 %d 汇总: %v", agg.TeamID, err)
+			agg.Skipped = append(agg.Skipped, s.MatchID)
+			continue
+		}
+		// 比赛数据里的双方战队为准，缺失时用战队比赛列表的 radiant 标记
+		if m.Sides.Side(agg.TeamID) != 0 {
+			s.Radiant, s.Dire = m.Sides.Radiant, m.Sides.Dire
+		}
+		wards := analytics.TeamWards(m.Wards, []analytics.Sides{s}, agg.TeamID)
+		agg.Wards = append(agg.Wards, wards...)
+		tm := teamMatch{MatchID: s.MatchID, Side: s.Side(agg.TeamID), Wards: len(wards)}
+		if !s.StartTime.IsZero() {
+			tm.StartTime = s.StartTime.Unix()
+		}
+		agg.Matches = append(agg.Matches, tm)
+	}
+	return nil
+}
+
+// parseDay 解析 YYYY-MM-DD（UTC），空串为零值（不过滤）
+func parseDay(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
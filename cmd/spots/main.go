@@ -0,0 +1,168 @@
+// 常用眼位：对库中多场比赛的眼位聚类（internal/spot），更新眼位目录文件并给眼位打 spot_id，或按眼位统计使用排行。
+// 用法:
+//
+//	spots -dsn wards.db -catalog spots.json [-patch 7.40 -since 2025-01-01] [-eps 150 -min-pts 5] [-assign]
+//	spots -store postgres -dsn postgres://... -catalog spots.json -top 10 [-team 8255888] [-ward-type observer] [-minutes 10-20]
+//
+// 第一种聚类后与目录中已有眼位对应（沿用 ID 与手工填写的 label），写回目录；-assign 时再按目录重写库中眼位的 spot_id。
+// 第二种按 spot_id 统计使用次数（需先 -assign），-team 为职业战队 ID，-minutes 为插眼时的游戏时间范围（分钟）。
+// 眼位库用 -store/-dsn 指定，与 cmd/serve 相同（sqlite 或 postgres）。
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cndotaplan/cndotaplan/internal/model"
+	"github.com/cndotaplan/cndotaplan/internal/spot"
+	"github.com/cndotaplan/cndotaplan/internal/storage"
+)
+
+func main() {
+	storeDriver := flag.String("store", "sqlite", "眼位库后端：sqlite 或 postgres")
+	storeDSN := flag.String("dsn", "", "眼位库：SQLite 文件路径（cmd/parse -dsn 写入）或 PostgreSQL 连接串")
+	catalogPath := flag.String("catalog", "spots.json", "眼位目录文件，不存在时新建")
+	patch := flag.String("patch", "", "只取该版本的比赛")
+	since := flag.String("since", "", "只取该日期（YYYY-MM-DD，UTC）及之后开始的比赛")
+	until := flag.String("until", "", "只取该日期（YYYY-MM-DD，UTC）之前开始的比赛")
+	eps := flag.Float64("eps", spot.DefaultOptions.Eps, "DBSCAN 邻域半径（世界单位）")
+	minPts := flag.Int("min-pts", spot.DefaultOptions.MinPts, "DBSCAN 核心点最少邻居数（含自身），即眼位至少被用过几次")
+	assign := flag.Bool("assign", false, "聚类后按目录重写库中全部眼位的 spot_id")
+	top := flag.Int("top", 0, "统计模式：输出使用次数前 N 的眼位（不聚类）")
+	team := flag.Int64("team", 0, "统计模式：只取该职业战队的眼位")
+	wardType := flag.String("ward-type", "", "统计模式：只取 observer 或 sentry")
+	minutes := flag.String("minutes", "", "统计模式：插眼时间范围（分钟），如 10-20")
+	flag.Parse()
+
+	if *storeDSN == "" {
+		fmt.Fprintln(os.Stderr, "用法: spots [-store sqlite|postgres] -dsn <dsn> -catalog <path> [-assign] | -top N [-team id] [-ward-type observer] [-minutes 10-20]")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	f := storage.WardFilter{Patch: *patch}
+	var err error
+	if f.Since, err = parseDate(*since); err == nil {
+		f.Until, err = parseDate(*until)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "日期格式应为 YYYY-MM-DD: %v\n", err)
+		os.Exit(1)
+	}
+	store, err := storage.Open(*storeDriver, *storeDSN)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "打开数据库失败: %v\n", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+	catalog, err := spot.LoadCatalog(*catalogPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取眼位目录失败: %v\n", err)
+		os.Exit(1)
+	}
+	ctx := context.Background()
+
+	if *top > 0 {
+		f.ProTeamID, f.WardType = *team, *wardType
+		from, to, err := parseMinutes(*minutes)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "-minutes: %v\n", err)
+			os.Exit(1)
+		}
+		records, err := store.Wards(ctx, f)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "读取眼位失败: %v\n", err)
+			os.Exit(1)
+		}
+		records = inMinutes(records, from, to)
+		writeTop(catalog, spot.Top(records, *top))
+		fmt.Fprintf(os.Stderr, "%d 条眼位\n", len(records))
+		return
+	}
+
+	records, err := store.Wards(ctx, f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取眼位失败: %v\n", err)
+		os.Exit(1)
+	}
+	// 各场按其版本的地图边界换算坐标
+	patches, err := store.MatchPatches(ctx, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取比赛版本失败: %v\n", err)
+		os.Exit(1)
+	}
+	bounds := spot.PatchBounds(patches)
+	found := spot.Cluster(records, bounds, spot.Options{Eps: *eps, MinPts: *minPts})
+	before := len(catalog.Spots)
+	catalog.Merge(found)
+	if err := catalog.Save(*catalogPath); err != nil {
+		fmt.Fprintf(os.Stderr, "写入眼位目录失败: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%d 条眼位聚成 %d 个眼位，目录 %s 共 %d 个（原有 %d 个）\n", len(records), len(found), *catalogPath, len(catalog.Spots), before)
+	if *assign {
+		n, err := store.AssignSpots(ctx, storage.WardFilter{}, func(w *model.WardRecord) string { return catalog.Assign(w, bounds) })
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "写入 spot_id 失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("更新 %d 条眼位的 spot_id\n", n)
+	}
+}
+
+func writeTop(catalog *spot.Catalog, usage []spot.Usage) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "spot_id\tcount\tshare\tregion\tlabel")
+	for _, u := range usage {
+		s, _ := catalog.Spot(u.SpotID)
+		fmt.Fprintf(tw, "%s\t%d\t%.3f\t%s\t%s\n", u.SpotID, u.Count, u.Share, s.Region, s.Label)
+	}
+	tw.Flush()
+}
+
+// parseMinutes 解析 "10-20" 或 "30-"（分钟），空串不限
+func parseMinutes(s string) (float64, float64, error) {
+	if s == "" {
+		return math.Inf(-1), math.Inf(1), nil
+	}
+	lo, hi, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("应为 <起>-<止>，如 10-20")
+	}
+	from, err := strconv.ParseFloat(lo, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	to := math.Inf(1)
+	if hi != "" {
+		if to, err = strconv.ParseFloat(hi, 64); err != nil {
+			return 0, 0, err
+		}
+	}
+	return from, to, nil
+}
+
+// inMinutes 插眼时间在 [from, to) 分钟内的眼
+func inMinutes(records []model.WardRecord, from, to float64) []model.WardRecord {
+	out := records[:0]
+	for _, w := range records {
+		if m := w.GameTimeSec / 60; m >= from && m < to {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// parseDate 解析 YYYY-MM-DD，空串为零值（不过滤）
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
@@ -0,0 +1,264 @@
+// 按队伍 × 区域 × 眼类型 × 游戏阶段统计眼数、眼位比例、持续时间比例与被反率（internal/analytics）。
+// 用法:
+//
+//	stats -dsn <path> [-matchid id] [-patch 7.40] [-since 2025-01-01] [-until 2026-01-01] [-format table|json|csv]
+//	stats -json 'out/*.json' [-phases 10,20,35] [-format csv -out stats.csv]   # cmd/parse -batch -out 或 OpenDota 脚本输出的眼位 JSON
+//	stats -dsn <path> -team 8255888 [-last 20 | -since 2025-01-01 -until 2026-01-01]
+//
+// -team 按职业战队汇总多场：每场取该队所在一方的眼位（阵营 → 战队取自录像元数据，-json 时读同目录的
+// <matchid>.match.json），并隐含 -normalize-side：夜魇方的眼位按地图中心对称到左下、区域标签互换，
+// 统计行统一记为 team_id 2。
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cndotaplan/cndotaplan/internal/analytics"
+	"github.com/cndotaplan/cndotaplan/internal/model"
+	"github.com/cndotaplan/cndotaplan/internal/region"
+	"github.com/cndotaplan/cndotaplan/internal/storage"
+)
+
+func main() {
+	storeDriver := flag.String("store", "sqlite", "眼位库后端：sqlite 或 postgres")
+	storeDSN := flag.String("dsn", "", "眼位库：SQLite 文件路径（cmd/parse -dsn 写入）或 PostgreSQL 连接串")
+	jsonGlob := flag.String("json", "", "眼位 JSON 文件或 glob（与 -dsn 二选一）；cmd/parse -batch -out 目录下的 <matchid>.match.json 等附带文件会被跳过")
+	matchID := flag.Int64("matchid", 0, "-dsn 时只统计该场")
+	patch := flag.String("patch", "", "-dsn 时只取该版本的比赛")
+	since := flag.String("since", "", "-dsn 或 -team 时只取该日期（YYYY-MM-DD，UTC）及之后开始的比赛")
+	until := flag.String("until", "", "-dsn 或 -team 时只取该日期（YYYY-MM-DD，UTC）之前开始的比赛")
+	team := flag.Int64("team", 0, "职业战队 ID：只统计该队的眼位，夜魇方的按地图中心对称到左下")
+	last := flag.Int("last", 0, "-team 时只取该队最近 N 场（按开始时间），0 为不限")
+	normalizeSide := flag.Bool("normalize-side", false, "夜魇方的眼位按地图中心对称到左下（区域标签互换），统计统一记为天辉；-team 时总是开启")
+	wardType := flag.String("ward-type", "", "只统计 observer 或 sentry")
+	phases := flag.String("phases", "15,30", "游戏阶段分界（分钟，逗号分隔），默认 0-15 / 15-30 / 30+")
+	format := flag.String("format", "table", "输出格式：table、json 或 csv")
+	outPath := flag.String("out", "", "输出文件，默认 stdout")
+	flag.Parse()
+
+	ph, err := analytics.ParsePhases(*phases)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-phases: %v\n", err)
+		os.Exit(1)
+	}
+	sinceT, errS := parseDate(*since)
+	untilT, errU := parseDate(*until)
+	if errS != nil || errU != nil {
+		fmt.Fprintln(os.Stderr, "-since/-until 格式应为 YYYY-MM-DD")
+		os.Exit(1)
+	}
+	var records []model.WardRecord
+	switch {
+	case *storeDSN != "" && *jsonGlob != "":
+		fmt.Fprintln(os.Stderr, "请只使用 -dsn、-json 之一")
+		os.Exit(1)
+	case *storeDSN != "":
+		f := storage.WardFilter{Patch: *patch, WardType: *wardType, Since: sinceT, Until: untilT, ProTeamID: *team, LastMatches: *last}
+		if *matchID != 0 {
+			f.MatchIDs = []int64{*matchID}
+		}
+		records, err = loadDB(*storeDriver, *storeDSN, f)
+	case *jsonGlob != "":
+		if records, err = loadJSON(*jsonGlob); err == nil && *team != 0 {
+			var sides []analytics.Sides
+			if sides, err = loadSides(*jsonGlob); err == nil {
+				records = analytics.TeamWards(records, analytics.TeamMatches(sides, *team, sinceT, untilT, *last), *team)
+			}
+		}
+		if err == nil && *wardType != "" {
+			records = filterType(records, *wardType)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "用法: stats -dsn <path> | -json <path|glob> [-format table|json|csv]")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取眼位失败: %v\n", err)
+		os.Exit(1)
+	}
+	if *team != 0 || *normalizeSide {
+		m, err := region.Load(*patch)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "加载区域数据: %v\n", err)
+			os.Exit(1)
+		}
+		analytics.NormalizeSide(records, m)
+	}
+	rows := analytics.Aggregate(records, analytics.Options{Phases: ph})
+
+	out := io.Writer(os.Stdout)
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "创建 %s 失败: %v\n", *outPath, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		out = f
+	}
+	switch *format {
+	case "table":
+		err = writeTable(out, rows)
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(rows)
+	case "csv":
+		err = writeCSV(out, rows)
+	default:
+		err = fmt.Errorf("未知格式 %q", *format)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "输出失败: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "%d 条眼位，%d 行统计\n", len(records), len(rows))
+}
+
+func loadDB(driver, dsn string, f storage.WardFilter) ([]model.WardRecord, error) {
+	store, err := storage.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	return store.Wards(context.Background(), f)
+}
+
+// loadJSON 读取 glob 匹配的眼位数组文件；批量输出目录中的 .match/.vision/.tracks/.trees 附带文件跳过
+func loadJSON(pattern string) ([]model.WardRecord, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%s 没有匹配的文件", pattern)
+	}
+	var all []model.WardRecord
+	for _, p := range paths {
+		if sidecar(p) {
+			continue
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		var records []model.WardRecord
+		if err := json.Unmarshal(data, &records); err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		all = append(all, records...)
+	}
+	return all, nil
+}
+
+// loadSides 读取各眼位文件（含 <matchid>.partial.json）同目录的 <matchid>.match.json（cmd/parse -batch -out 输出的 model.MatchInfo），
+// 得到每场双方的职业战队；没有该文件的比赛跳过
+func loadSides(pattern string) ([]analytics.Sides, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var out []analytics.Sides
+	for _, p := range paths {
+		if sidecar(p) {
+			continue
+		}
+		data, err := os.ReadFile(matchInfoPath(p))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var info model.MatchInfo
+		if err := json.Unmarshal(data, &info); err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		out = append(out, analytics.SidesFromInfo(info))
+	}
+	return out, nil
+}
+
+// matchInfoPath 眼位文件对应的 <matchid>.match.json；部分结果 <matchid>.partial.json 与完整结果共用同一份
+func matchInfoPath(path string) string {
+	if base := strings.TrimSuffix(path, ".partial.json"); base != path {
+		return base + ".match.json"
+	}
+	return strings.TrimSuffix(path, ".json") + ".match.json"
+}
+
+// sidecar cmd/parse -batch -out 与眼位 JSON 放在一起的其它输出
+func sidecar(path string) bool {
+	for _, suffix := range []string{".match.json", ".vision.json", ".tracks.json", ".trees.json"} {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func filterType(records []model.WardRecord, wardType string) []model.WardRecord {
+	out := records[:0]
+	for _, w := range records {
+		if w.WardType == wardType {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// parseDate 解析 YYYY-MM-DD，空串为零值（不过滤）
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+var header = []string{"team_id", "region", "ward_type", "phase", "count", "share", "censored", "unknown_duration",
+	"mean_duration_ratio", "median_duration_ratio", "dewarded", "dewarded_rate"}
+
+func fields(r analytics.Row) []string {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', 3, 64) }
+	return []string{
+		strconv.Itoa(int(r.TeamID)), r.Region, r.WardType, r.Phase, strconv.Itoa(r.Count), f(r.Share), strconv.Itoa(r.Censored), strconv.Itoa(r.UnknownDuration),
+		f(r.MeanDurationRatio), f(r.MedianDurationRatio), strconv.Itoa(r.Dewarded), f(r.DewardedRate),
+	}
+}
+
+func writeTable(w io.Writer, rows []analytics.Row) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, strings.Join(header, "\t")+"\t")
+	for _, r := range rows {
+		fmt.Fprintln(tw, strings.Join(fields(r), "\t")+"\t")
+	}
+	return tw.Flush()
+}
+
+func writeCSV(w io.Writer, rows []analytics.Row) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		if err := cw.Write(fields(r)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
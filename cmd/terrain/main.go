@@ -0,0 +1,110 @@
+// 地形数据转换：把从地图文件（VPK 中的 maps/dota.vpk）导出的高度图与实体表转成 internal/terrain.File，
+// 供 cmd/serve -terrain、cmd/heatmap -terrain 计算眼位视野的遮挡。
+// 用法:
+//
+//	terrain -patch 7.40 -elevation 740_height.png -entities 740_entities.txt [-out terrain.json]
+//
+// -elevation 为每格一像素的灰度高度图（第 0 行为地图最上方），-elevation-step 为相邻两层地面相差的灰度；
+// -entities 为实体表的文本导出（Source 2 Viewer 的 entity lump），取其中 ent_dota_tree 与
+// ent_fow_blocker_node 的位置标记树与视野阻挡物。-out 已存在时加入或替换该版本，其他版本保留。
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	_ "image/png"
+	"io/fs"
+	"os"
+
+	"github.com/cndotaplan/cndotaplan/internal/coord"
+	"github.com/cndotaplan/cndotaplan/internal/terrain"
+)
+
+func main() {
+	patch := flag.String("patch", "", "版本，如 7.40")
+	elevationPath := flag.String("elevation", "", "路径: 高度图 PNG，每格一像素")
+	entitiesPath := flag.String("entities", "", "路径: 地图实体表文本导出")
+	minX := flag.Float64("min-x", 0, "高度图左下角格子的世界 x；默认取该版本地图边界")
+	minY := flag.Float64("min-y", 0, "高度图左下角格子的世界 y；默认取该版本地图边界")
+	cellSize := flag.Float64("cell", terrain.DefaultCellSize, "格子边长（世界单位）")
+	step := flag.Float64("elevation-step", 64, "高度图中相邻两层地面相差的灰度")
+	treeRadius := flag.Float64("tree-radius", terrain.DefaultTreeRadius, "一棵树挡视野的半径（世界单位）")
+	blockerRadius := flag.Float64("blocker-radius", terrain.DefaultCellSize/2, "视野阻挡物的半径（世界单位）")
+	outPath := flag.String("out", "terrain.json", "输出的地形文件")
+	flag.Parse()
+
+	if *patch == "" || *elevationPath == "" || *entitiesPath == "" {
+		fmt.Fprintln(os.Stderr, "用法: terrain -patch <patch> -elevation <png> -entities <txt> [-out terrain.json]")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	bounds := coord.BoundsFor(*patch)
+	if *minX == 0 {
+		*minX = bounds.MinX
+	}
+	if *minY == 0 {
+		*minY = bounds.MinY
+	}
+
+	fh, err := os.Open(*elevationPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "打开高度图失败: %v\n", err)
+		os.Exit(1)
+	}
+	img, _, err := image.Decode(fh)
+	fh.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取高度图失败: %v\n", err)
+		os.Exit(1)
+	}
+	grid, err := terrain.FromHeightmap(*patch, img, *minX, *minY, *cellSize, *step)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	fh, err = os.Open(*entitiesPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "打开实体表失败: %v\n", err)
+		os.Exit(1)
+	}
+	ents, err := terrain.ParseEntities(fh)
+	fh.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取实体表失败: %v\n", err)
+		os.Exit(1)
+	}
+	trees, err := terrain.Origins(ents, terrain.TreeClass)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	blockers, err := terrain.Origins(ents, terrain.BlockerClass)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if len(trees) == 0 {
+		fmt.Fprintf(os.Stderr, "实体表中没有 %s，确认导出的是 dota 地图的实体表\n", terrain.TreeClass)
+		os.Exit(1)
+	}
+	treeCells := grid.MarkTrees(trees, *treeRadius)
+	blockerCells := grid.MarkBlockers(blockers, *blockerRadius)
+
+	file := &terrain.File{Version: 1}
+	if old, err := terrain.LoadFile(*outPath); err == nil {
+		file = old
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "读取 %s 失败: %v\n", *outPath, err)
+		os.Exit(1)
+	}
+	file.Put(grid)
+	if err := file.Save(*outPath); err != nil {
+		fmt.Fprintf(os.Stderr, "写入地形文件失败: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s: %d×%d 格，%d 棵树（%d 格），%d 个视野阻挡物（%d 格），写入 %s\n",
+		*patch, grid.Width, grid.Height, len(trees), treeCells, len(blockers), blockerCells, *outPath)
+}
@@ -2,11 +2,29 @@ module github.com/cndotaplan/cndotaplan
 
 go 1.19
 
-require github.com/dotabuff/manta v1.4.7
+require (
+	github.com/dotabuff/manta v1.4.7
+	github.com/golang/snappy v0.0.3
+	github.com/klauspost/compress v1.17.4
+	github.com/lib/pq v1.10.9
+	google.golang.org/protobuf v1.26.0
+	modernc.org/sqlite v1.29.10
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/dustin/go-humanize v1.0.1 // indirect
 	github.com/golang/protobuf v1.5.2 // indirect
-	github.com/golang/snappy v0.0.3 // indirect
-	google.golang.org/protobuf v1.26.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/ncruces/go-strftime v0.1.9 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
+	golang.org/x/sys v0.19.0 // indirect
+	modernc.org/gc/v3 v3.0.0-20240107210532-573471604cb6 // indirect
+	modernc.org/libc v1.49.3 // indirect
+	modernc.org/mathutil v1.6.0 // indirect
+	modernc.org/memory v1.8.0 // indirect
+	modernc.org/strutil v1.2.0 // indirect
+	modernc.org/token v1.1.0 // indirect
 )
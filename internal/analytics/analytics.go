@@ -0,0 +1,215 @@
+// Package analytics 眼位指标聚合：按队伍 × 区域 × 眼类型 × 游戏阶段统计眼数、眼位比例、
+// 持续时间比例与被反率，定义见 docs/design.md 第 1 节。
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cndotaplan/cndotaplan/internal/model"
+	"github.com/cndotaplan/cndotaplan/internal/region"
+)
+
+// Phase 游戏阶段，按插眼时的游戏时间 [StartSec, EndSec) 划分；最后一段 EndSec 为 +Inf
+type Phase struct {
+	Name     string
+	StartSec float64
+	EndSec   float64
+}
+
+// DefaultPhases 0–15 / 15–30 / 30+ 分钟
+var DefaultPhases = MustPhases(15, 30)
+
+// MustPhases 按分钟分界点生成阶段，如 (15, 30) → 0-15、15-30、30+
+func MustPhases(boundaries ...float64) []Phase {
+	p, err := NewPhases(boundaries...)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// NewPhases 同 MustPhases，分界点须为正且递增
+func NewPhases(boundaries ...float64) ([]Phase, error) {
+	var out []Phase
+	prev := 0.0
+	for _, b := range boundaries {
+		if b <= prev {
+			return nil, fmt.Errorf("analytics: phase boundaries must be positive and increasing: %v", boundaries)
+		}
+		out = append(out, Phase{Name: fmtMin(prev) + "-" + fmtMin(b), StartSec: prev * 60, EndSec: b * 60})
+		prev = b
+	}
+	return append(out, Phase{Name: fmtMin(prev) + "+", StartSec: prev * 60, EndSec: math.Inf(1)}), nil
+}
+
+// ParsePhases 解析逗号分隔的分钟分界点，如 "15,30"；空串为 DefaultPhases
+func ParsePhases(s string) ([]Phase, error) {
+	if strings.TrimSpace(s) == "" {
+		return DefaultPhases, nil
+	}
+	var bounds []float64
+	for _, f := range strings.Split(s, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return nil, fmt.Errorf("analytics: phase boundary %q: %w", f, err)
+		}
+		bounds = append(bounds, v)
+	}
+	return NewPhases(bounds...)
+}
+
+func fmtMin(m float64) string {
+	return strconv.FormatFloat(m, 'f', -1, 64)
+}
+
+// phaseOf 插眼时刻所在阶段；开局前（负时间）算第一段
+func phaseOf(phases []Phase, sec float64) string {
+	for _, p := range phases {
+		if sec < p.EndSec {
+			return p.Name
+		}
+	}
+	return phases[len(phases)-1].Name
+}
+
+// Options 聚合参数
+type Options struct {
+	Phases []Phase // 为空时用 DefaultPhases
+}
+
+// Row 一个 队伍 × 区域 × 眼类型 × 阶段 的统计
+type Row struct {
+	TeamID   int32  `json:"team_id"`
+	Region   string `json:"region"`
+	WardType string `json:"ward_type"`
+	Phase    string `json:"phase"`
+	Count    int    `json:"count"`
+	// Share 眼位比例：该区域眼数 / 该队同类型同阶段的总眼数
+	Share float64 `json:"share"`
+	// Censored 录像结束（或截断）时仍存活的眼数；它们的时长只是下界，不计入下面的时长与被反统计
+	Censored int `json:"censored"`
+	// UnknownDuration 没有时长的眼（如 OpenDota 的 obs_log 只有插眼时刻），同样只计入 count 与 share
+	UnknownDuration     int     `json:"unknown_duration"`
+	MeanDurationRatio   float64 `json:"mean_duration_ratio"`
+	MedianDurationRatio float64 `json:"median_duration_ratio"`
+	Dewarded            int     `json:"dewarded"`
+	// DewardedRate 被反眼数 / 未删失且时长已知的眼数
+	DewardedRate float64 `json:"dewarded_rate"`
+}
+
+type key struct {
+	team     int32
+	region   string
+	wardType string
+	phase    string
+}
+
+// Aggregate 统计 records；结果按队伍、眼类型、阶段、眼数（降序）、区域排序
+func Aggregate(records []model.WardRecord, opts Options) []Row {
+	phases := opts.Phases
+	if len(phases) == 0 {
+		phases = DefaultPhases
+	}
+	groups := map[key][]*model.WardRecord{}
+	totals := map[key]int{} // region 为空：该队同类型同阶段总数
+	for i := range records {
+		w := &records[i]
+		tag := w.RegionTag
+		if tag == "" {
+			tag = region.Other
+		}
+		k := key{team: w.TeamID, region: tag, wardType: w.WardType, phase: phaseOf(phases, w.GameTimeSec)}
+		groups[k] = append(groups[k], w)
+		k.region = ""
+		totals[k]++
+	}
+	order := map[string]int{}
+	for i, p := range phases {
+		order[p.Name] = i
+	}
+
+	rows := make([]Row, 0, len(groups))
+	for k, ws := range groups {
+		row := Row{TeamID: k.team, Region: k.region, WardType: k.wardType, Phase: k.phase, Count: len(ws)}
+		row.Share = float64(len(ws)) / float64(totals[key{team: k.team, wardType: k.wardType, phase: k.phase}])
+		var ratios []float64
+		for _, w := range ws {
+			if censored(w) {
+				row.Censored++
+				continue
+			}
+			if unknownDuration(w) {
+				row.UnknownDuration++
+				continue
+			}
+			ratios = append(ratios, w.DurationRatio())
+			if dewarded(w) {
+				row.Dewarded++
+			}
+		}
+		if n := len(ratios); n > 0 {
+			row.MeanDurationRatio = mean(ratios)
+			row.MedianDurationRatio = median(ratios)
+			row.DewardedRate = float64(row.Dewarded) / float64(n)
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		switch {
+		case a.TeamID != b.TeamID:
+			return a.TeamID < b.TeamID
+		case a.WardType != b.WardType:
+			return a.WardType < b.WardType
+		case a.Phase != b.Phase:
+			return order[a.Phase] < order[b.Phase]
+		case a.Count != b.Count:
+			return a.Count > b.Count
+		}
+		return a.Region < b.Region
+	})
+	return rows
+}
+
+// censored 右删失：录像结束或截断时仍存活
+func censored(w *model.WardRecord) bool {
+	return w.AliveAtEnd || w.RemovalCause == model.RemovalGameEnd || w.RemovalCause == model.RemovalTruncated
+}
+
+// unknownDuration 没有移除时间的记录：时长为 0 且没有移除原因，时长比例无从计算
+func unknownDuration(w *model.WardRecord) bool {
+	return w.DurationSec <= 0 && w.RemovalCause == ""
+}
+
+// dewarded 被敌方反掉；没有战斗日志的数据（OpenDota）或原因未知时退回 IsDenied 的时长推断
+func dewarded(w *model.WardRecord) bool {
+	switch w.RemovalCause {
+	case model.RemovalDewarded:
+		return true
+	case "", model.RemovalUnknown:
+		return w.IsDenied
+	}
+	return false
+}
+
+func mean(v []float64) float64 {
+	s := 0.0
+	for _, x := range v {
+		s += x
+	}
+	return s / float64(len(v))
+}
+
+func median(v []float64) float64 {
+	s := append([]float64(nil), v...)
+	sort.Float64s(s)
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
@@ -0,0 +1,97 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+
+	"github.com/cndotaplan/cndotaplan/internal/model"
+	"github.com/cndotaplan/cndotaplan/internal/region"
+)
+
+func TestParsePhases(t *testing.T) {
+	p, err := ParsePhases("10, 25")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p) != 3 || p[0].Name != "0-10" || p[1].Name != "10-25" || p[2].Name != "25+" || !math.IsInf(p[2].EndSec, 1) {
+		t.Errorf("phases %+v", p)
+	}
+	if p, _ := ParsePhases(" "); len(p) != len(DefaultPhases) {
+		t.Errorf("empty phases = %+v, want DefaultPhases", p)
+	}
+	for _, bad := range []string{"30,15", "0", "a"} {
+		if _, err := ParsePhases(bad); err == nil {
+			t.Errorf("ParsePhases(%q) accepted", bad)
+		}
+	}
+	if got := phaseOf(DefaultPhases, -30); got != "0-15" {
+		t.Errorf("pre-horn ward in phase %q, want 0-15", got)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	obs := func(team int32, tag string, sec, dur float64) model.WardRecord {
+		return model.WardRecord{TeamID: team, WardType: "observer", RegionTag: tag, GameTimeSec: sec, DurationSec: dur, RemovalCause: model.RemovalExpired}
+	}
+	records := []model.WardRecord{
+		obs(2, region.RadiantJungle, 60, 360),
+		obs(2, region.RadiantJungle, 120, 180),
+		obs(2, region.RadiantJungle, 300, 90),
+		obs(2, "", 200, 360),
+		obs(2, region.DireJungle, 1200, 360),
+		obs(3, region.DireJungle, 100, 360),
+	}
+	records[1].RemovalCause = model.RemovalDewarded
+	// 原因未知时按 IsDenied 推断
+	records[2].RemovalCause, records[2].IsDenied = "", true
+	// 录像结束时仍存活：只计入眼数
+	records[3].RemovalCause, records[3].AliveAtEnd = model.RemovalGameEnd, true
+
+	rows := Aggregate(records, Options{})
+	if len(rows) != 4 {
+		t.Fatalf("%d rows, want 4: %+v", len(rows), rows)
+	}
+	jungle := rows[0]
+	if jungle.TeamID != 2 || jungle.Region != region.RadiantJungle || jungle.Phase != "0-15" {
+		t.Fatalf("first row %+v, want team 2 radiant jungle 0-15", jungle)
+	}
+	if jungle.Count != 3 || math.Abs(jungle.Share-0.75) > 1e-9 {
+		t.Errorf("count %d share %v, want 3 and 0.75", jungle.Count, jungle.Share)
+	}
+	if jungle.Censored != 0 || jungle.Dewarded != 2 || math.Abs(jungle.DewardedRate-2.0/3) > 1e-9 {
+		t.Errorf("censored %d dewarded %d rate %v", jungle.Censored, jungle.Dewarded, jungle.DewardedRate)
+	}
+	if math.Abs(jungle.MeanDurationRatio-0.875/1.5) > 1e-9 || jungle.MedianDurationRatio != 0.5 {
+		t.Errorf("mean %v median %v", jungle.MeanDurationRatio, jungle.MedianDurationRatio)
+	}
+	other := rows[1]
+	if other.Region != region.Other || other.Count != 1 || other.Censored != 1 || other.MeanDurationRatio != 0 {
+		t.Errorf("untagged row %+v, want one censored ward in %q", other, region.Other)
+	}
+	if rows[2].Phase != "15-30" || rows[2].Share != 1 {
+		t.Errorf("third row %+v, want the 15-30 phase alone", rows[2])
+	}
+	if rows[3].TeamID != 3 {
+		t.Errorf("last row %+v, want team 3", rows[3])
+	}
+}
+
+func TestAggregateUnknownDuration(t *testing.T) {
+	// OpenDota 的眼只有插眼时刻：不应把时长比例拉向 0
+	records := []model.WardRecord{
+		{TeamID: 2, WardType: "observer", RegionTag: region.River, GameTimeSec: 60, DurationSec: 180, RemovalCause: model.RemovalDewarded},
+		{TeamID: 2, WardType: "observer", RegionTag: region.River, GameTimeSec: 90},
+		{TeamID: 2, WardType: "observer", RegionTag: region.River, GameTimeSec: 120},
+	}
+	rows := Aggregate(records, Options{})
+	if len(rows) != 1 {
+		t.Fatalf("%d rows, want 1: %+v", len(rows), rows)
+	}
+	r := rows[0]
+	if r.Count != 3 || r.UnknownDuration != 2 || r.Censored != 0 {
+		t.Errorf("count %d unknown %d censored %d, want 3, 2, 0", r.Count, r.UnknownDuration, r.Censored)
+	}
+	if r.MeanDurationRatio != 0.5 || r.MedianDurationRatio != 0.5 || r.Dewarded != 1 || r.DewardedRate != 1 {
+		t.Errorf("mean %v median %v dewarded %d rate %v, want 0.5, 0.5, 1, 1", r.MeanDurationRatio, r.MedianDurationRatio, r.Dewarded, r.DewardedRate)
+	}
+}
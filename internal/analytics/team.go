@@ -0,0 +1,116 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+
+	"github.com/cndotaplan/cndotaplan/internal/coord"
+	"github.com/cndotaplan/cndotaplan/internal/model"
+	"github.com/cndotaplan/cndotaplan/internal/region"
+)
+
+// Sides 一场比赛天辉/夜魇对应的职业战队 ID（非战队比赛为 0），来自录像元数据或 OpenDota 比赛数据
+type Sides struct {
+	MatchID   int64     `json:"match_id"`
+	StartTime time.Time `json:"start_time"` // 未知时为零值
+	Radiant   int64     `json:"radiant_team_id"`
+	Dire      int64     `json:"dire_team_id"`
+}
+
+// SidesFromInfo 录像解析出的比赛元数据
+func SidesFromInfo(info model.MatchInfo) Sides {
+	s := Sides{MatchID: info.MatchID, Radiant: info.RadiantTeam.ID, Dire: info.DireTeam.ID}
+	if info.StartTime > 0 {
+		s.StartTime = time.Unix(info.StartTime, 0).UTC()
+	}
+	return s
+}
+
+// Side 职业战队 teamID 在该场的阵营：2=天辉 3=夜魇，未参赛为 0
+func (s Sides) Side(teamID int64) int32 {
+	switch {
+	case teamID == 0:
+		return 0
+	case s.Radiant == teamID:
+		return 2
+	case s.Dire == teamID:
+		return 3
+	}
+	return 0
+}
+
+// TeamMatches 职业战队 teamID 参加的比赛，开始时间在 [since, until)（零值不限）内、按开始时间倒序的最近 last 场
+// （last <= 0 不限）；未知开始时间的比赛不会命中时间条件，且排在最后
+func TeamMatches(sides []Sides, teamID int64, since, until time.Time, last int) []Sides {
+	var out []Sides
+	for _, s := range sides {
+		if s.Side(teamID) == 0 {
+			continue
+		}
+		if (!since.IsZero() || !until.IsZero()) && s.StartTime.IsZero() {
+			continue
+		}
+		if (!since.IsZero() && s.StartTime.Before(since)) || (!until.IsZero() && !s.StartTime.Before(until)) {
+			continue
+		}
+		out = append(out, s)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.StartTime.IsZero() != b.StartTime.IsZero() {
+			return b.StartTime.IsZero()
+		}
+		if !a.StartTime.Equal(b.StartTime) {
+			return a.StartTime.After(b.StartTime)
+		}
+		return a.MatchID > b.MatchID
+	})
+	if last > 0 && len(out) > last {
+		out = out[:last]
+	}
+	return out
+}
+
+// TeamWards 取出职业战队 teamID 在各场所属一方的眼位；sides 中没有的比赛跳过
+func TeamWards(records []model.WardRecord, sides []Sides, teamID int64) []model.WardRecord {
+	side := map[int64]int32{}
+	for _, s := range sides {
+		if t := s.Side(teamID); t != 0 {
+			side[s.MatchID] = t
+		}
+	}
+	var out []model.WardRecord
+	for _, w := range records {
+		if t, ok := side[w.MatchID]; ok && w.TeamID == t {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// NormalizeSide 原地把夜魇方的眼位按地图中心点对称（coord.Bounds.Mirror，含版本的不对称修正），
+// 区域标签换成对方的（region.MirrorTag，没有标签的按新位置打标），并记为天辉方（TeamID 2），
+// 使多场汇总时同一战队的眼位总在左下（天辉角）。(0, 0) 表示未解析出坐标，只改阵营与标签。
+func NormalizeSide(records []model.WardRecord, m *region.Map) {
+	b := coord.BoundsFor(m.Patch)
+	guessed := coord.GuessSpace(records)
+	for i := range records {
+		w := &records[i]
+		if w.TeamID != 3 {
+			continue
+		}
+		w.TeamID = 2
+		w.RegionTag = region.MirrorTag(w.RegionTag)
+		if w.PosX == 0 && w.PosY == 0 {
+			continue
+		}
+		space := coord.Space(w.CoordSpace)
+		if space == "" {
+			space = guessed
+		}
+		w.PosX, w.PosY = b.Mirror(w.PosX, w.PosY, space)
+		if w.RegionTag == "" {
+			w.RegionTag = m.TagIn(w.PosX, w.PosY, space)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+// Package coord 坐标系换算：录像世界坐标、OpenDota 网格、归一化 0–1 与地图图片像素。
+//
+//   - World：parser 输出的 cell*128 + vec，地图中心约在 (16384, 16384)
+//   - Grid：OpenDota obs_log / sen_log 的 x、y，等于 World / 128
+//   - Normalized：按版本地图边界归一化到 0–1，原点在左下（天辉角）
+//   - 像素：在地图底图（如 asset/detailed_740.webp）上的像素，原点在左上，y 向下
+package coord
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cndotaplan/cndotaplan/internal/model"
+)
+
+// Space WardRecord.CoordSpace 的取值
+type Space string
+
+const (
+	World      Space = "world"
+	Grid       Space = "opendota_grid"
+	Normalized Space = "normalized"
+)
+
+// GridUnit 一个 OpenDota 网格对应的世界单位（即 Source 2 的 cell 大小）
+const GridUnit = 128
+
+// Bounds 某版本地图底图覆盖的世界坐标范围
+type Bounds struct {
+	Patch string
+	MinX  float64
+	MinY  float64
+	MaxX  float64
+	MaxY  float64
+	// MirrorFixes 该版本地图不对称处的修正，见 Mirror
+	MirrorFixes []MirrorFix
+}
+
+// MirrorFix 地图不完全中心对称处的修正（网格坐标）：At 为某地物的实际位置，Ideal 为对方同一地物
+// 点对称后的位置。At 附近 Radius 以内的点向 Ideal 平移（在 At 处完整平移、到 Radius 处衰减为 0），
+// 得到「对称化」的地图，见 Mirror。每对地物只登记一侧；平移距离须小于 Radius，以保证平移可逆。
+type MirrorFix struct {
+	Name   string
+	At     [2]float64
+	Ideal  [2]float64
+	Radius float64
+}
+
+// mirrorFixes733 7.33 扩图后的不对称地物，按 asset/detailed_740.webp 目测的约值：
+// 双方魔方（Tormentor）不在彼此的中心对称位置（天辉 (152, 101)、夜魇 (101, 159)），
+// 远古野（三角区）入口夜魇侧偏西（天辉 (146, 88)、夜魇 (108, 168)）
+var mirrorFixes733 = []MirrorFix{
+	{Name: "夜魇魔方", At: [2]float64{101, 159}, Ideal: [2]float64{104, 155}, Radius: 8},
+	{Name: "夜魇三角区", At: [2]float64{108, 168}, Ideal: [2]float64{110, 168}, Radius: 10},
+}
+
+// patchBounds 各版本底图边界（世界坐标），按版本升序。7.33 扩图后可玩区约为网格 64–192，
+// asset/detailed_740.webp（900×900）按此裁切。
+var patchBounds = []Bounds{
+	{Patch: "7.33", MinX: 64 * GridUnit, MinY: 64 * GridUnit, MaxX: 192 * GridUnit, MaxY: 192 * GridUnit, MirrorFixes: mirrorFixes733},
+	{Patch: "7.40", MinX: 64 * GridUnit, MinY: 64 * GridUnit, MaxX: 192 * GridUnit, MaxY: 192 * GridUnit, MirrorFixes: mirrorFixes733},
+}
+
+// BoundsFor 取不晚于 patch 的最新版本边界，patch 为空时取最新
+func BoundsFor(patch string) Bounds {
+	if patch == "" {
+		return patchBounds[len(patchBounds)-1]
+	}
+	i := sort.Search(len(patchBounds), func(i int) bool { return ComparePatch(patchBounds[i].Patch, patch) > 0 })
+	if i == 0 {
+		return patchBounds[0]
+	}
+	return patchBounds[i-1]
+}
+
+// WorldToGrid 录像世界坐标 → OpenDota 网格
+func WorldToGrid(x, y float64) (float64, float64) {
+	return x / GridUnit, y / GridUnit
+}
+
+// GridToWorld OpenDota 网格 → 录像世界坐标
+func GridToWorld(x, y float64) (float64, float64) {
+	return x * GridUnit, y * GridUnit
+}
+
+// WorldToNormalized 世界坐标 → 0–1（边界外的点会超出 0–1，不截断）
+func (b Bounds) WorldToNormalized(x, y float64) (float64, float64) {
+	return (x - b.MinX) / (b.MaxX - b.MinX), (y - b.MinY) / (b.MaxY - b.MinY)
+}
+
+// NormalizedToWorld 0–1 → 世界坐标
+func (b Bounds) NormalizedToWorld(nx, ny float64) (float64, float64) {
+	return b.MinX + nx*(b.MaxX-b.MinX), b.MinY + ny*(b.MaxY-b.MinY)
+}
+
+// NormalizedToPixel 0–1 → 宽 w、高 h 的图片像素（y 轴翻转）
+func NormalizedToPixel(nx, ny float64, w, h int) (float64, float64) {
+	return nx * float64(w), (1 - ny) * float64(h)
+}
+
+// PixelToNormalized 图片像素 → 0–1
+func PixelToNormalized(px, py float64, w, h int) (float64, float64) {
+	return px / float64(w), 1 - py/float64(h)
+}
+
+// ToWorld 把 space 下的坐标换算为世界坐标；未知 space 按世界坐标处理
+func (b Bounds) ToWorld(x, y float64, space Space) (float64, float64) {
+	switch space {
+	case Grid:
+		return GridToWorld(x, y)
+	case Normalized:
+		return b.NormalizedToWorld(x, y)
+	default:
+		return x, y
+	}
+}
+
+// FromWorld 把世界坐标换算到 space 下
+func (b Bounds) FromWorld(x, y float64, space Space) (float64, float64) {
+	switch space {
+	case Grid:
+		return WorldToGrid(x, y)
+	case Normalized:
+		return b.WorldToNormalized(x, y)
+	default:
+		return x, y
+	}
+}
+
+// Convert 在任意两个坐标系之间换算
+func (b Bounds) Convert(x, y float64, from, to Space) (float64, float64) {
+	if from == to {
+		return x, y
+	}
+	wx, wy := b.ToWorld(x, y, from)
+	return b.FromWorld(wx, wy, to)
+}
+
+// Mirror 把 space 下的坐标换到对方视角：天辉角 ↔ 夜魇角。先按 MirrorFixes 把地图平移成中心对称
+// （warp），按边界中心点对称，再做逆平移；因此一方的地物准确地映到对方的同一地物，且 Mirror 两次回到原处。
+// 用于把夜魇方的眼位换到天辉方视角比较。
+func (b Bounds) Mirror(x, y float64, space Space) (float64, float64) {
+	wx, wy := b.ToWorld(x, y, space)
+	gx, gy := WorldToGrid(wx, wy)
+	gx, gy = b.warp(gx, gy)
+	cx, cy := WorldToGrid(b.MinX+b.MaxX, b.MinY+b.MaxY)
+	gx, gy = b.unwarp(cx-gx, cy-gy)
+	wx, wy = GridToWorld(gx, gy)
+	return b.FromWorld(wx, wy, space)
+}
+
+// warp 网格坐标按 MirrorFixes 平移后的位置
+func (b Bounds) warp(x, y float64) (float64, float64) {
+	dx, dy := 0.0, 0.0
+	for _, f := range b.MirrorFixes {
+		d := math.Hypot(x-f.At[0], y-f.At[1])
+		if d >= f.Radius {
+			continue
+		}
+		k := 1 - d/f.Radius
+		dx += k * (f.Ideal[0] - f.At[0])
+		dy += k * (f.Ideal[1] - f.At[1])
+	}
+	return x + dx, y + dy
+}
+
+// unwarp warp 的逆：平移量随位置变化的斜率小于 1，不动点迭代收敛
+func (b Bounds) unwarp(x, y float64) (float64, float64) {
+	px, py := x, y
+	for i := 0; i < 100; i++ {
+		wx, wy := b.warp(px, py)
+		nx, ny := x-(wx-px), y-(wy-py)
+		if math.Abs(nx-px) < 1e-12 && math.Abs(ny-py) < 1e-12 {
+			return nx, ny
+		}
+		px, py = nx, ny
+	}
+	return px, py
+}
+
+// GuessSpace 为没有 coord_space 的旧数据推断坐标系：超过网格范围的视为世界坐标，
+// 全部落在 0–1 内的视为归一化，其余视为 OpenDota 网格。
+func GuessSpace(records []model.WardRecord) Space {
+	maxV := 0.0
+	for _, w := range records {
+		if w.PosX > maxV {
+			maxV = w.PosX
+		}
+		if w.PosY > maxV {
+			maxV = w.PosY
+		}
+	}
+	switch {
+	case maxV > 256:
+		return World
+	case maxV > 0 && maxV <= 1:
+		return Normalized
+	default:
+		return Grid
+	}
+}
+
+// ConvertRecords 原地把眼位坐标换算到 to 坐标系并更新 CoordSpace；CoordSpace 为空的记录按 GuessSpace 推断。
+// (0, 0) 表示未解析出坐标，保持不变。
+func (b Bounds) ConvertRecords(records []model.WardRecord, to Space) {
+	guessed := GuessSpace(records)
+	for i := range records {
+		w := &records[i]
+		from := Space(w.CoordSpace)
+		if from == "" {
+			from = guessed
+		}
+		if w.PosX != 0 || w.PosY != 0 {
+			w.PosX, w.PosY = b.Convert(w.PosX, w.PosY, from, to)
+		}
+		w.CoordSpace = string(to)
+	}
+}
+
+// ComparePatch 按数字段比较版本号，如 "7.39" < "7.40" < "7.40b"
+func ComparePatch(a, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var sa, sb string
+		if i < len(pa) {
+			sa = pa[i]
+		}
+		if i < len(pb) {
+			sb = pb[i]
+		}
+		na, ra := splitNum(sa)
+		nb, rb := splitNum(sb)
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+		if ra != rb {
+			return strings.Compare(ra, rb)
+		}
+	}
+	return 0
+}
+
+func splitNum(s string) (int, string) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	n, _ := strconv.Atoi(s[:i])
+	return n, s[i:]
+}
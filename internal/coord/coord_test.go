@@ -0,0 +1,221 @@
+package coord
+
+import (
+	"math"
+	"testing"
+
+	"github.com/cndotaplan/cndotaplan/internal/model"
+)
+
+const eps = 1e-9
+
+func near(a, b float64) bool { return math.Abs(a-b) <= eps*math.Max(1, math.Abs(b)) }
+
+// samplePoints 每个版本边界内外的一组网格坐标：四角、中心、边界外
+var samplePoints = [][2]float64{
+	{64, 64}, {192, 192}, {64, 192}, {192, 64}, {128, 128}, {100.25, 155.5}, {50, 210},
+}
+
+func TestRoundTrip(t *testing.T) {
+	const w, h = 900, 900
+	for _, b := range patchBounds {
+		t.Run(b.Patch, func(t *testing.T) {
+			for _, p := range samplePoints {
+				gx, gy := p[0], p[1]
+				wx, wy := GridToWorld(gx, gy)
+				if x, y := WorldToGrid(wx, wy); !near(x, gx) || !near(y, gy) {
+					t.Errorf("grid %v → world → grid = (%v, %v)", p, x, y)
+				}
+				nx, ny := b.WorldToNormalized(wx, wy)
+				if x, y := b.NormalizedToWorld(nx, ny); !near(x, wx) || !near(y, wy) {
+					t.Errorf("world (%v, %v) → normalized → world = (%v, %v)", wx, wy, x, y)
+				}
+				px, py := NormalizedToPixel(nx, ny, w, h)
+				if x, y := PixelToNormalized(px, py, w, h); !near(x, nx) || !near(y, ny) {
+					t.Errorf("normalized (%v, %v) → pixel → normalized = (%v, %v)", nx, ny, x, y)
+				}
+				// 任意两个坐标系之间经 Convert 往返
+				spaces := []Space{World, Grid, Normalized}
+				for _, from := range spaces {
+					x0, y0 := b.FromWorld(wx, wy, from)
+					for _, to := range spaces {
+						x1, y1 := b.Convert(x0, y0, from, to)
+						if x, y := b.Convert(x1, y1, to, from); !near(x, x0) || !near(y, y0) {
+							t.Errorf("%v: %s → %s → %s = (%v, %v), want (%v, %v)", p, from, to, from, x, y, x0, y0)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestKnownValues(t *testing.T) {
+	for _, b := range patchBounds {
+		// 7.33 之后可玩区为网格 64–192：左下角为归一化 (0, 0)、像素左下，中心为 (0.5, 0.5)
+		if x, y := b.Convert(64, 64, Grid, Normalized); !near(x, 0) || !near(y, 0) {
+			t.Errorf("%s: grid (64, 64) → normalized (%v, %v)", b.Patch, x, y)
+		}
+		if x, y := b.Convert(128, 128, Grid, Normalized); !near(x, 0.5) || !near(y, 0.5) {
+			t.Errorf("%s: grid (128, 128) → normalized (%v, %v)", b.Patch, x, y)
+		}
+		if x, y := NormalizedToPixel(0, 0, 900, 900); x != 0 || y != 900 {
+			t.Errorf("normalized (0, 0) → pixel (%v, %v), want (0, 900)", x, y)
+		}
+		if x, y := b.Convert(16384, 16384, World, Grid); x != 128 || y != 128 {
+			t.Errorf("%s: world centre → grid (%v, %v)", b.Patch, x, y)
+		}
+	}
+}
+
+func TestBoundsFor(t *testing.T) {
+	cases := map[string]string{
+		"":      "7.40",
+		"7.32":  "7.33", // 早于所有版本时用最早的
+		"7.33":  "7.33",
+		"7.39d": "7.33",
+		"7.40":  "7.40",
+		"7.40b": "7.40",
+		"7.41":  "7.40",
+	}
+	for patch, want := range cases {
+		if got := BoundsFor(patch).Patch; got != want {
+			t.Errorf("BoundsFor(%q) = %s, want %s", patch, got, want)
+		}
+	}
+}
+
+func TestGuessSpace(t *testing.T) {
+	recs := func(v ...float64) []model.WardRecord {
+		var out []model.WardRecord
+		for _, x := range v {
+			out = append(out, model.WardRecord{PosX: x, PosY: x / 2})
+		}
+		return out
+	}
+	cases := []struct {
+		name string
+		in   []model.WardRecord
+		want Space
+	}{
+		{"empty", nil, Grid},
+		{"all unparsed (0, 0)", recs(0, 0), Grid},
+		{"normalized", recs(0.2, 0.9), Normalized},
+		{"normalized upper edge", recs(1), Normalized},
+		{"just above 1 is grid", recs(1.0001), Grid},
+		{"grid", recs(80, 180), Grid},
+		{"grid upper edge", recs(256), Grid},
+		{"world", recs(256.5), World},
+		{"world", recs(8000, 24000), World},
+		{"y decides", []model.WardRecord{{PosX: 0.5, PosY: 300}}, World},
+		{"negative only", recs(-5), Grid},
+	}
+	for _, c := range cases {
+		if got := GuessSpace(c.in); got != c.want {
+			t.Errorf("%s: GuessSpace = %s, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestConvertRecords(t *testing.T) {
+	b := BoundsFor("7.40")
+	recs := []model.WardRecord{
+		{PosX: 100, PosY: 150}, // 无 coord_space，按 GuessSpace 视为网格
+		{PosX: 0, PosY: 0},     // 未解析出坐标，保持 (0, 0)
+		{PosX: 0.5, PosY: 0.5, CoordSpace: string(Normalized)},
+	}
+	b.ConvertRecords(recs, World)
+	if recs[0].PosX != 12800 || recs[0].PosY != 19200 || recs[0].CoordSpace != string(World) {
+		t.Errorf("grid record → %+v", recs[0])
+	}
+	if recs[1].PosX != 0 || recs[1].PosY != 0 || recs[1].CoordSpace != string(World) {
+		t.Errorf("unparsed record → %+v", recs[1])
+	}
+	if recs[2].PosX != 16384 || recs[2].PosY != 16384 {
+		t.Errorf("normalized record → %+v", recs[2])
+	}
+}
+
+func TestComparePatch(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"7.39", "7.40", -1},
+		{"7.40", "7.40b", -1},
+		{"7.40b", "7.40c", -1},
+		{"7.9", "7.10", -1},
+		{"7.40", "7.40", 0},
+		{"8.0", "7.99", 1},
+	}
+	for _, c := range cases {
+		if got := ComparePatch(c.a, c.b); got != c.want {
+			t.Errorf("ComparePatch(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+		if got := ComparePatch(c.b, c.a); got != -c.want {
+			t.Errorf("ComparePatch(%q, %q) = %d, want %d", c.b, c.a, got, -c.want)
+		}
+	}
+}
+
+func TestMirrorInvolution(t *testing.T) {
+	for _, b := range patchBounds {
+		worst := 0.0
+		for x := 60.0; x <= 196; x += 0.5 {
+			for y := 60.0; y <= 196; y += 0.5 {
+				mx, my := b.Mirror(x, y, Grid)
+				rx, ry := b.Mirror(mx, my, Grid)
+				worst = math.Max(worst, math.Hypot(rx-x, ry-y))
+			}
+		}
+		if worst > 1e-6 {
+			t.Errorf("%s: Mirror twice is off by up to %v grid", b.Patch, worst)
+		}
+		// 其他坐标系下同样可逆
+		for _, space := range []Space{World, Normalized} {
+			x0, y0 := b.Convert(103, 157, Grid, space)
+			mx, my := b.Mirror(x0, y0, space)
+			if x, y := b.Mirror(mx, my, space); !near(x, x0) || !near(y, y0) {
+				t.Errorf("%s %s: Mirror twice = (%v, %v), want (%v, %v)", b.Patch, space, x, y, x0, y0)
+			}
+		}
+	}
+}
+
+// TestMirrorFixes 目测的不对称修正：双方魔方与三角区入口互相对应，修正范围外为纯点对称。
+// 改动 mirrorFixes733 时这里的坐标需要按底图重新核对。
+func TestMirrorFixes(t *testing.T) {
+	pairs := []struct {
+		name    string
+		radiant [2]float64
+		dire    [2]float64
+	}{
+		{"魔方", [2]float64{152, 101}, [2]float64{101, 159}},
+		{"三角区", [2]float64{146, 88}, [2]float64{108, 168}},
+	}
+	for _, patch := range []string{"7.33", "7.40"} {
+		b := BoundsFor(patch)
+		if len(b.MirrorFixes) != len(pairs) {
+			t.Fatalf("%s: %d mirror fixes, want %d", patch, len(b.MirrorFixes), len(pairs))
+		}
+		for _, f := range b.MirrorFixes {
+			if d := math.Hypot(f.Ideal[0]-f.At[0], f.Ideal[1]-f.At[1]); d >= f.Radius {
+				t.Errorf("%s %s: shift %v not below radius %v, warp is not invertible", patch, f.Name, d, f.Radius)
+			}
+		}
+		for _, p := range pairs {
+			if x, y := b.Mirror(p.radiant[0], p.radiant[1], Grid); math.Hypot(x-p.dire[0], y-p.dire[1]) > 1e-6 {
+				t.Errorf("%s: 天辉%s → (%v, %v), want %v", patch, p.name, x, y, p.dire)
+			}
+			if x, y := b.Mirror(p.dire[0], p.dire[1], Grid); math.Hypot(x-p.radiant[0], y-p.radiant[1]) > 1e-6 {
+				t.Errorf("%s: 夜魇%s → (%v, %v), want %v", patch, p.name, x, y, p.radiant)
+			}
+		}
+		// 远离修正处：关于 (128, 128) 点对称
+		for _, p := range [][2]float64{{128, 128}, {70, 80}, {180, 190}, {90, 110}} {
+			if x, y := b.Mirror(p[0], p[1], Grid); !near(x, 256-p[0]) || !near(y, 256-p[1]) {
+				t.Errorf("%s: Mirror%v = (%v, %v), want (%v, %v)", patch, p, x, y, 256-p[0], 256-p[1])
+			}
+		}
+	}
+}
@@ -0,0 +1,358 @@
+// Package downloader 录像获取：通过 OpenDota 把 match_id 解析为 replay_url，断点续传下载 .dem.bz2，
+// 校验大小与 bzip2 完整性后按内容哈希存放。
+//
+// 目录结构（Dir 下）：
+//
+//	objects/ab/abcdef….dem.bz2   按 SHA-256 存放的录像本体
+//	<matchid>_<salt>.dem.bz2     指向 objects 的链接，文件名与 Valve CDN 一致，供 cmd/parse 等按 match_id 查找
+//	tmp/                         下载中的 .part 文件，中断后下次续传
+package downloader
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL OpenDota API 地址
+const DefaultBaseURL = "https://api.opendota.com/api"
+
+// ErrNoReplay OpenDota 没有该场的 replay_url（未解析、已过期或非公开比赛）
+var ErrNoReplay = errors.New("downloader: no replay_url")
+
+// Client 录像下载器，零值字段使用默认值
+type Client struct {
+	BaseURL   string       // OpenDota API 地址，可指向本地 mock 服务
+	HTTP      *http.Client // 默认 http.DefaultClient
+	Dir       string       // 录像根目录
+	UserAgent string
+	Retries   int           // 下载失败后的重试次数（续传），默认 3
+	Backoff   time.Duration // 重试间隔基数，按次数线性增加，默认 2s
+}
+
+// New 创建下载到 dir 的客户端
+func New(dir string) *Client {
+	return &Client{Dir: dir}
+}
+
+func (c *Client) baseURL() string {
+	if c.BaseURL != "" {
+		return strings.TrimRight(c.BaseURL, "/")
+	}
+	return DefaultBaseURL
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTP != nil {
+		return c.HTTP
+	}
+	return http.DefaultClient
+}
+
+func (c *Client) get(ctx context.Context, u string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	ua := c.UserAgent
+	if ua == "" {
+		ua = "CnDotaPlan/1.0"
+	}
+	req.Header.Set("User-Agent", ua)
+	return c.httpClient().Do(req)
+}
+
+func (c *Client) getJSON(ctx context.Context, u string, v interface{}) error {
+	resp, err := c.get(ctx, u, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("downloader: GET %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// ReplayURL GET /matches/{id} 取 replay_url
+func (c *Client) ReplayURL(ctx context.Context, matchID int64) (string, error) {
+	var m struct {
+		ReplayURL string `json:"replay_url"`
+	}
+	if err := c.getJSON(ctx, fmt.Sprintf("%s/matches/%d", c.baseURL(), matchID), &m); err != nil {
+		return "", err
+	}
+	if m.ReplayURL == "" {
+		return "", ErrNoReplay
+	}
+	return m.ReplayURL, nil
+}
+
+// ProMatchIDs GET /proMatches 取最近 limit 场职业比赛（OpenDota 单页最多 100 场，超过时用 less_than_match_id 翻页）
+func (c *Client) ProMatchIDs(ctx context.Context, limit int) ([]int64, error) {
+	var ids []int64
+	var lessThan int64
+	for len(ids) < limit {
+		u := c.baseURL() + "/proMatches"
+		if lessThan > 0 {
+			u += "?less_than_match_id=" + strconv.FormatInt(lessThan, 10)
+		}
+		var page []struct {
+			MatchID int64 `json:"match_id"`
+		}
+		if err := c.getJSON(ctx, u, &page); err != nil {
+			return nil, err
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, m := range page {
+			ids = append(ids, m.MatchID)
+			lessThan = m.MatchID
+		}
+	}
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	return ids, nil
+}
+
+// Existing 返回 Dir 下该场已下载的录像路径，没有时返回 ""
+func (c *Client) Existing(matchID int64) string {
+	matches, _ := filepath.Glob(filepath.Join(c.Dir, fmt.Sprintf("%d_*.dem.bz2", matchID)))
+	for _, p := range matches {
+		if _, err := os.Stat(p); err == nil { // Stat 跟随链接，断链视为不存在
+			return p
+		}
+	}
+	return ""
+}
+
+// Download 解析 replay_url 并下载；已存在时直接返回本地路径
+func (c *Client) Download(ctx context.Context, matchID int64) (string, error) {
+	if p := c.Existing(matchID); p != "" {
+		return p, nil
+	}
+	u, err := c.ReplayURL(ctx, matchID)
+	if err != nil {
+		return "", err
+	}
+	return c.Fetch(ctx, u)
+}
+
+// Fetch 下载 replayURL 指向的 .dem.bz2，失败时按 Retries 续传重试；返回 Dir 下以 URL 文件名命名的链接路径
+func (c *Client) Fetch(ctx context.Context, replayURL string) (string, error) {
+	name, err := replayFileName(replayURL)
+	if err != nil {
+		return "", err
+	}
+	linkPath := filepath.Join(c.Dir, name)
+	if _, err := os.Stat(linkPath); err == nil {
+		return linkPath, nil
+	}
+	if err := os.MkdirAll(filepath.Join(c.Dir, "tmp"), 0o755); err != nil {
+		return "", err
+	}
+	partPath := filepath.Join(c.Dir, "tmp", name+".part")
+
+	retries := c.Retries
+	if retries <= 0 {
+		retries = 3
+	}
+	backoff := c.Backoff
+	if backoff <= 0 {
+		backoff = 2 * time.Second
+	}
+	for attempt := 0; ; attempt++ {
+		err = c.fetchPart(ctx, replayURL, partPath)
+		if err == nil || attempt >= retries || ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff * time.Duration(attempt+1)):
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := verifyBzip2(partPath); err != nil {
+		// 内容已损坏，续传无法修复，删除后下次从头下载
+		os.Remove(partPath)
+		return "", err
+	}
+	return c.store(partPath, linkPath)
+}
+
+// fetchPart 把 replayURL 下载（或续传）到 partPath，并校验总大小
+func (c *Client) fetchPart(ctx context.Context, replayURL, partPath string) error {
+	var offset int64
+	if fi, err := os.Stat(partPath); err == nil {
+		offset = fi.Size()
+	}
+	header := http.Header{}
+	if offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := c.get(ctx, replayURL, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var total int64 = -1
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// 服务端不支持 Range 或首次下载：从头写
+		flags |= os.O_TRUNC
+		offset = 0
+		total = resp.ContentLength
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+		total = contentRangeTotal(resp.Header.Get("Content-Range"))
+	case http.StatusRequestedRangeNotSatisfiable:
+		// .part 已是完整文件
+		return nil
+	default:
+		return fmt.Errorf("downloader: GET %s: %s", replayURL, resp.Status)
+	}
+
+	f, err := os.OpenFile(partPath, flags, 0o644)
+	if err != nil {
+		return err
+	}
+	n, copyErr := io.Copy(f, resp.Body)
+	if err := f.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	if copyErr != nil {
+		return fmt.Errorf("downloader: download %s: %w", replayURL, copyErr)
+	}
+	if total >= 0 && offset+n != total {
+		return fmt.Errorf("downloader: size mismatch for %s: got %d, want %d", replayURL, offset+n, total)
+	}
+	return nil
+}
+
+// store 把校验通过的 .part 移到 objects/<sha256> 并在 Dir 下建立以原文件名命名的链接
+func (c *Client) store(partPath, linkPath string) (string, error) {
+	sum, err := fileSHA256(partPath)
+	if err != nil {
+		return "", err
+	}
+	rel := filepath.Join("objects", sum[:2], sum+".dem.bz2")
+	objPath := filepath.Join(c.Dir, rel)
+	if err := os.MkdirAll(filepath.Dir(objPath), 0o755); err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(objPath); err == nil {
+		os.Remove(partPath) // 内容相同的录像已存在
+	} else if err := os.Rename(partPath, objPath); err != nil {
+		return "", err
+	}
+	os.Remove(linkPath)
+	if err := os.Symlink(rel, linkPath); err != nil {
+		// 不支持符号链接的文件系统退回硬链接
+		if err := os.Link(objPath, linkPath); err != nil {
+			return "", err
+		}
+	}
+	return linkPath, nil
+}
+
+// verifyBzip2 完整解压一遍确认 bzip2 流无损坏，并检查解压后是 Source 2 录像（PBDEMS2）
+func verifyBzip2(p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bzip2.NewReader(bufio.NewReader(f))
+	magic := make([]byte, 8)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return fmt.Errorf("downloader: corrupt bzip2 %s: %w", p, err)
+	}
+	if string(magic) != "PBDEMS2\x00" {
+		return fmt.Errorf("downloader: %s is not a Source 2 replay", p)
+	}
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return fmt.Errorf("downloader: corrupt bzip2 %s: %w", p, err)
+	}
+	return nil
+}
+
+func fileSHA256(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// contentRangeTotal 解析 "bytes 100-199/200" 中的总长度，未知时返回 -1
+func contentRangeTotal(v string) int64 {
+	i := strings.LastIndex(v, "/")
+	if i < 0 {
+		return -1
+	}
+	n, err := strconv.ParseInt(v[i+1:], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// replayFileName 取 URL 的文件名，如 http://replay123.valve.net/570/8678990124_1234.dem.bz2 → 8678990124_1234.dem.bz2
+func replayFileName(replayURL string) (string, error) {
+	u, err := url.Parse(replayURL)
+	if err != nil {
+		return "", err
+	}
+	name := path.Base(u.Path)
+	if !strings.HasSuffix(name, ".dem.bz2") {
+		return "", fmt.Errorf("downloader: unexpected replay url %q", replayURL)
+	}
+	return name, nil
+}
+
+// MatchIDFromName 从 Valve 录像文件名 <matchid>_<salt>.dem[.bz2] 推断 match_id（也接受 <matchid>.dem[.bz2]），
+// 无法推断时返回 false
+func MatchIDFromName(p string) (int64, bool) {
+	name := filepath.Base(p)
+	if i := strings.Index(name, ".dem"); i > 0 {
+		name = name[:i]
+	} else {
+		return 0, false
+	}
+	if i := strings.IndexByte(name, '_'); i >= 0 {
+		name = name[:i]
+	}
+	id, err := strconv.ParseInt(name, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return id, true
+}
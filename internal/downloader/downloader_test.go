@@ -0,0 +1,157 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// replay "PBDEMS2\x00hello" 经 bzip2 -9 压缩
+var replay = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0xba, 0x4c,
+	0xaf, 0x77, 0x00, 0x00, 0x03, 0x4f, 0x00, 0x40, 0x00, 0x10, 0x00, 0x16,
+	0x02, 0x48, 0x00, 0x02, 0x44, 0xa0, 0x00, 0x22, 0x00, 0x68, 0xd0, 0x40,
+	0xd0, 0x34, 0x18, 0x09, 0xab, 0xec, 0x3a, 0x79, 0x3c, 0x5d, 0xc9, 0x14,
+	0xe1, 0x42, 0x42, 0xe9, 0x32, 0xbd, 0xdc,
+}
+
+const replayName = "8100000001_77.dem.bz2"
+
+// cdn 支持 Range 的录像服务；cut > 0 时第一次请求只发出前 cut 字节就断开
+type cdn struct {
+	data []byte
+	cut  int
+
+	mu     sync.Mutex
+	ranges []string // 各次请求的 Range 头
+}
+
+func (c *cdn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	c.ranges = append(c.ranges, r.Header.Get("Range"))
+	first := len(c.ranges) == 1
+	c.mu.Unlock()
+	if first && c.cut > 0 {
+		w.Header().Set("Content-Length", fmt.Sprint(len(c.data)))
+		w.Write(c.data[:c.cut])
+		return // 少于 Content-Length，服务端关闭连接
+	}
+	http.ServeContent(w, r, replayName, time.Time{}, bytes.NewReader(c.data))
+}
+
+func newTestClient(t *testing.T, h http.Handler) (*Client, string) {
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	c := &Client{Dir: t.TempDir(), Retries: 2, Backoff: time.Millisecond}
+	return c, srv.URL + "/570/" + replayName
+}
+
+func checkStored(t *testing.T, c *Client, p string) {
+	t.Helper()
+	if p != filepath.Join(c.Dir, replayName) {
+		t.Errorf("path %s, want %s under Dir", p, replayName)
+	}
+	got, err := os.ReadFile(p)
+	if err != nil || !bytes.Equal(got, replay) {
+		t.Errorf("stored replay %d bytes, %v", len(got), err)
+	}
+	if _, err := os.Stat(filepath.Join(c.Dir, "tmp", replayName+".part")); !os.IsNotExist(err) {
+		t.Errorf(".part left behind: %v", err)
+	}
+}
+
+func TestFetchResumes(t *testing.T) {
+	srv := &cdn{data: replay, cut: 20}
+	c, u := newTestClient(t, srv)
+	p, err := c.Fetch(context.Background(), u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStored(t, c, p)
+	if len(srv.ranges) != 2 || srv.ranges[0] != "" || srv.ranges[1] != "bytes=20-" {
+		t.Errorf("requests with Range %q, want a full request then bytes=20-", srv.ranges)
+	}
+	// 已下载：不再请求
+	if p2, err := c.Fetch(context.Background(), u); err != nil || p2 != p || len(srv.ranges) != 2 {
+		t.Errorf("second Fetch = %s, %v after %d requests", p2, err, len(srv.ranges))
+	}
+}
+
+func TestFetchCompletePart(t *testing.T) {
+	srv := &cdn{data: replay}
+	c, u := newTestClient(t, srv)
+	// 上次已下载完整但未来得及校验：续传请求越界，服务端回 416
+	os.MkdirAll(filepath.Join(c.Dir, "tmp"), 0o755)
+	if err := os.WriteFile(filepath.Join(c.Dir, "tmp", replayName+".part"), replay, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := c.Fetch(context.Background(), u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStored(t, c, p)
+	if want := fmt.Sprintf("bytes=%d-", len(replay)); len(srv.ranges) != 1 || srv.ranges[0] != want {
+		t.Errorf("requests with Range %q, want one %s", srv.ranges, want)
+	}
+}
+
+func TestFetchCorrupt(t *testing.T) {
+	bad := append([]byte(nil), replay...)
+	bad[len(bad)-5] ^= 0xff
+	c, u := newTestClient(t, &cdn{data: bad})
+	if _, err := c.Fetch(context.Background(), u); err == nil {
+		t.Fatal("corrupt replay accepted")
+	}
+	if _, err := os.Stat(filepath.Join(c.Dir, "tmp", replayName+".part")); !os.IsNotExist(err) {
+		t.Errorf("corrupt .part kept: %v", err)
+	}
+	if p := c.Existing(8100000001); p != "" {
+		t.Errorf("Existing = %s after a corrupt download", p)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/570/", &cdn{data: replay})
+	c, u := newTestClient(t, mux)
+	mux.HandleFunc("/api/matches/8100000001", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"match_id": 8100000001, "replay_url": %q}`, u)
+	})
+	mux.HandleFunc("/api/matches/8100000002", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"match_id": 8100000002}`)
+	})
+	c.BaseURL = u[:len(u)-len("/570/"+replayName)] + "/api/"
+	p, err := c.Download(context.Background(), 8100000001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStored(t, c, p)
+	if got := c.Existing(8100000001); got != p {
+		t.Errorf("Existing = %q, want %q", got, p)
+	}
+	if _, err := c.Download(context.Background(), 8100000002); err != ErrNoReplay {
+		t.Errorf("match without replay_url: %v, want ErrNoReplay", err)
+	}
+}
+
+func TestMatchIDFromName(t *testing.T) {
+	cases := map[string]int64{
+		"/data/8100000001_77.dem.bz2": 8100000001,
+		"8100000001.dem":              8100000001,
+		"8100000001_77.dem.zst":       8100000001,
+		"replay.dem":                  0,
+		"8100000001.txt":              0,
+	}
+	for name, want := range cases {
+		if got, ok := MatchIDFromName(name); got != want || ok != (want != 0) {
+			t.Errorf("MatchIDFromName(%q) = %d, %v; want %d", name, got, ok, want)
+		}
+	}
+}
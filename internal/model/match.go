@@ -0,0 +1,47 @@
+package model
+
+// MatchInfo 比赛元数据，来自录像的 CDemoFileHeader、CDemoFileInfo 与 game rules，对应 matches 表（见 docs/design.md）
+type MatchInfo struct {
+	MatchID     int64        `json:"match_id"`
+	StartTime   int64        `json:"start_time,omitempty"` // Unix 秒，由结束时间减去时长推算；未知为 0
+	DurationSec float64      `json:"duration_sec"`         // 号角到比赛结束（遗迹被摧毁/GG）的游戏时间
+	Build       int32        `json:"build,omitempty"`      // 服务器版本号（CDemoFileHeader.build_num）
+	Patch       string       `json:"patch,omitempty"`      // 游戏版本，如 "7.40"，见 parser.PatchAt
+	GameMode    int32        `json:"game_mode,omitempty"`  // DOTA_GameMode，2 = 队长模式
+	LeagueID    int64        `json:"league_id,omitempty"`  // 非联赛比赛为 0
+	Winner      int32        `json:"winner,omitempty"`     // 2=天辉 3=夜魇，未知为 0
+	RadiantTeam TeamInfo     `json:"radiant_team"`
+	DireTeam    TeamInfo     `json:"dire_team"`
+	PicksBans   []PickBan    `json:"picks_bans,omitempty"` // 按 BP 顺序
+	Players     []PlayerInfo `json:"players,omitempty"`
+}
+
+// TeamInfo 职业战队，非战队比赛 ID 为 0
+type TeamInfo struct {
+	ID  int64  `json:"id,omitempty"`
+	Tag string `json:"tag,omitempty"`
+}
+
+// PickBan 一次选人或禁用
+type PickBan struct {
+	Order  int   `json:"order"` // 从 0 开始
+	IsPick bool  `json:"is_pick"`
+	TeamID int32 `json:"team_id"` // 2=天辉 3=夜魇
+	HeroID int32 `json:"hero_id"`
+}
+
+// PlayerInfo 录像结束时的玩家信息
+type PlayerInfo struct {
+	TeamID     int32  `json:"team_id"`
+	AccountID  uint32 `json:"account_id,omitempty"` // Steam 32 位 account_id
+	PlayerName string `json:"player_name,omitempty"`
+	HeroName   string `json:"hero_name,omitempty"` // npc_dota_hero_xxx
+}
+
+// Team 取 teamID（2/3）一方的战队
+func (m *MatchInfo) Team(teamID int32) TeamInfo {
+	if teamID == 3 {
+		return m.DireTeam
+	}
+	return m.RadiantTeam
+}
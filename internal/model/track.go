@@ -0,0 +1,71 @@
+package model
+
+import "math"
+
+// HeroTrack 一名英雄按固定游戏时间间隔采样的位置与存活状态。
+// 第 i 个采样对应游戏时间 StartSec + i*IntervalSec；坐标为世界坐标取整（地图范围内不超出 int16），
+// 存活状态按位存放，10 名英雄一场约 150 KB。
+type HeroTrack struct {
+	MatchID     int64   `json:"match_id"`
+	PlayerSlot  int32   `json:"player_slot"` // 与 WardRecord 一致：0-4 天辉，128-132 夜魇
+	TeamID      int32   `json:"team_id"`
+	HeroName    string  `json:"hero_name"`
+	StartSec    float64 `json:"start_sec"`
+	IntervalSec float64 `json:"interval_sec"`
+	X           []int16 `json:"x"`
+	Y           []int16 `json:"y"`
+	Alive       []byte  `json:"alive"`               // 位图：第 i 个采样存活为 Alive[i/8]>>(i%8)&1
+	Invisible   []byte  `json:"invisible,omitempty"` // 位图，同 Alive：身上有隐身类状态（隐身、进雾等），只有真视能看到
+}
+
+// Len 采样数
+func (t *HeroTrack) Len() int {
+	return len(t.X)
+}
+
+// Append 追加一个采样
+func (t *HeroTrack) Append(x, y float64, alive, invisible bool) {
+	i := len(t.X)
+	t.X = append(t.X, clampInt16(x))
+	t.Y = append(t.Y, clampInt16(y))
+	t.Alive = setBit(t.Alive, i, alive)
+	t.Invisible = setBit(t.Invisible, i, invisible)
+}
+
+func setBit(bits []byte, i int, v bool) []byte {
+	for len(bits) <= i/8 {
+		bits = append(bits, 0)
+	}
+	if v {
+		bits[i/8] |= 1 << (i % 8)
+	}
+	return bits
+}
+
+// InvisibleAt 第 i 个采样时是否隐身
+func (t *HeroTrack) InvisibleAt(i int) bool {
+	return i/8 < len(t.Invisible) && t.Invisible[i/8]>>(i%8)&1 == 1
+}
+
+// At 第 i 个采样
+func (t *HeroTrack) At(i int) (x, y float64, alive bool) {
+	return float64(t.X[i]), float64(t.Y[i]), i/8 < len(t.Alive) && t.Alive[i/8]>>(i%8)&1 == 1
+}
+
+// TimeAt 第 i 个采样的游戏时间
+func (t *HeroTrack) TimeAt(i int) float64 {
+	return t.StartSec + float64(i)*t.IntervalSec
+}
+
+// Index 游戏时间 sec 之前（含）最近的采样，超出采样范围时返回 false
+func (t *HeroTrack) Index(sec float64) (int, bool) {
+	if t.IntervalSec <= 0 || sec < t.StartSec {
+		return 0, false
+	}
+	i := int((sec - t.StartSec) / t.IntervalSec)
+	return i, i < t.Len()
+}
+
+func clampInt16(v float64) int16 {
+	return int16(math.Max(math.MinInt16, math.Min(math.MaxInt16, math.Round(v))))
+}
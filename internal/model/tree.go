@@ -0,0 +1,33 @@
+package model
+
+// TreeEvent 一次树的变化：一棵地图树被摧毁，或种下一棵临时树（铁树枝、发芽等）。
+// 砍树取自战斗日志的砍树记录（每条一棵树及其位置）。
+type TreeEvent struct {
+	MatchID     int64   `json:"match_id"`
+	Kind        string  `json:"kind"`  // 见 Tree* 常量
+	Cause       string  `json:"cause"` // 砍树的物品或技能名（战斗日志没有给出时为空）；种树为实体类名
+	TeamID      int32   `json:"team_id"`
+	PlayerSlot  int32   `json:"player_slot"` // 与 WardRecord 一致，未知为 -1
+	HeroName    string  `json:"hero_name,omitempty"`
+	PosX        float64 `json:"pos_x"`
+	PosY        float64 `json:"pos_y"`
+	CoordSpace  string  `json:"coord_space"`
+	Radius      float64 `json:"radius"` // 砍掉的树所占的半径（世界单位，一棵树 terrain.DefaultTreeRadius）；种树为 0
+	GameTimeSec float64 `json:"game_time_sec"`
+	// DurationSec 砍掉的树多久后重新长出（录像结束时仍未长回的截至录像结束），种下的树存在多久
+	DurationSec float64 `json:"duration_sec"`
+}
+
+// 树变化类型（TreeEvent.Kind）
+const (
+	TreeCut     = "cut"     // 砍树
+	TreePlanted = "planted" // 种下的临时树
+)
+
+// TreeRegrowSec 地图树被砍后重新长出的默认时间（秒）；录像中读不到这棵树何时长回时使用
+const TreeRegrowSec = 300
+
+// Active 游戏时间 sec 时该变化是否生效（树仍缺失或临时树仍在）
+func (e *TreeEvent) Active(sec float64) bool {
+	return sec >= e.GameTimeSec && sec < e.GameTimeSec+e.DurationSec
+}
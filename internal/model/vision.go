@@ -0,0 +1,37 @@
+package model
+
+// VisionEvent 眼位以外的视野事件（雾、粉、宝石、哨塔、扫描、双生门），与 WardRecord 一起在时间轴上展示
+type VisionEvent struct {
+	MatchID int64  `json:"match_id"`
+	Kind    string `json:"kind"`    // 见 Vision* 常量
+	TeamID  int32  `json:"team_id"` // 使用方/持有方 2=天辉 3=夜魇
+	// 使用者，与 WardRecord 一致；扫描等无法确定玩家时 PlayerSlot 为 -1
+	PlayerSlot  int32   `json:"player_slot"`
+	AccountID   uint32  `json:"account_id,omitempty"`
+	PlayerName  string  `json:"player_name,omitempty"`
+	HeroName    string  `json:"hero_name,omitempty"`
+	PosX        float64 `json:"pos_x"` // 发生位置：扫描为扫描中心，其余为使用者（或哨塔）所在位置
+	PosY        float64 `json:"pos_y"`
+	CoordSpace  string  `json:"coord_space"`
+	GameTimeSec float64 `json:"game_time_sec"`
+	// DurationSec 效果持续时长：雾为使用者身上雾的持续时间，宝石为本次持有时长，哨塔为本次占领时长；
+	// 临时夜晚为夜晚持续时间；粉、扫描、双生门为瞬时事件，按游戏内固定时长或 0
+	DurationSec float64 `json:"duration_sec"`
+	AliveAtEnd  bool    `json:"alive_at_end,omitempty"` // 录像结束时仍在持续（宝石/哨塔），DurationSec 为下界
+	Heroes      int     `json:"heroes,omitempty"`       // 雾：同时进雾的英雄数
+	RegionTag   string  `json:"region_tag"`
+}
+
+// 视野事件类型（VisionEvent.Kind）
+const (
+	VisionSmoke    = "smoke"     // 诡计之雾
+	VisionDust     = "dust"      // 显影之尘
+	VisionGem      = "gem"       // 真视宝石：一次持有（拾取/购买 → 死亡掉落/转交/出售）
+	VisionWatcher  = "watcher"   // 哨塔（灯笼）被占领
+	VisionScan     = "scan"      // 扫描
+	VisionTwinGate = "twin_gate" // 双生门传送
+	VisionNight    = "night"     // 临时夜晚（黑暗飞升、月蚀等），使用者为暗夜猎手时即黑暗飞升；不区分队伍，TeamID 为使用方
+)
+
+// ScanDurationSec 扫描持续时间（秒）
+const ScanDurationSec = 8
@@ -2,33 +2,78 @@ package model
 
 // WardRecord 单条眼位记录（解析结果）
 type WardRecord struct {
-	MatchID     int64   `json:"match_id"`
-	TeamID      int32   `json:"team_id"`       // 2=天辉 3=夜魇
-	WardType    string  `json:"ward_type"`     // "observer" | "sentry"
+	MatchID  int64  `json:"match_id"`
+	TeamID   int32  `json:"team_id"`   // 2=天辉 3=夜魇
+	WardType string `json:"ward_type"` // "observer" | "sentry"
+	// 插眼玩家与英雄，见 docs/design.md；PlayerSlot 与 OpenDota 一致（0-4 天辉，128-132 夜魇），未知为 -1
+	PlayerSlot  int32   `json:"player_slot"`
+	AccountID   uint32  `json:"account_id,omitempty"` // Steam 32 位 account_id
+	PlayerName  string  `json:"player_name,omitempty"`
+	HeroID      int32   `json:"hero_id,omitempty"`
+	HeroName    string  `json:"hero_name,omitempty"` // npc_dota_hero_xxx
 	PosX        float64 `json:"pos_x"`
 	PosY        float64 `json:"pos_y"`
-	GameTimeSec float64 `json:"game_time_sec"` // 插眼时游戏内时间（秒）
+	CoordSpace  string  `json:"coord_space"`   // pos_x/pos_y 所在坐标系：world / opendota_grid / normalized，见 internal/coord
+	GameTimeSec float64 `json:"game_time_sec"` // 插眼时游戏内时间（秒，号角为 0，开局前为负，与 OpenDota 一致）
 	DurationSec float64 `json:"duration_sec"`  // 实际存活时长（秒）
 	IsDenied    bool    `json:"is_denied"`     // 是否疑似被反
-	RegionTag   string  `json:"region_tag"`    // 预定义区域，见 docs/design.md
+	AliveAtEnd  bool    `json:"alive_at_end"`  // 录像结束时仍存活（右删失），DurationSec 只是下界
+	// 移除原因与击杀者，来自战斗日志；OpenDota 数据没有这些字段
+	RemovalCause string `json:"removal_cause,omitempty"` // 见 Removal* 常量
+	KillerUnit   string `json:"killer_unit,omitempty"`   // 击杀者单位名，如 npc_dota_hero_zuus
+	KillerTeam   int32  `json:"killer_team,omitempty"`   // 击杀者队伍 2/3
+	KillerIsHero bool   `json:"killer_is_hero,omitempty"`
+	BountyGold   int32  `json:"bounty_gold,omitempty"` // 击杀者获得的赏金
+	BountyXP     int32  `json:"bounty_xp,omitempty"`   // 击杀者获得的经验
+	RegionTag    string `json:"region_tag"`            // 预定义区域，见 docs/design.md
+	// 视野统计，需要英雄位置采样，见 internal/vision.Spotted
+	SpottedHeroSec float64 `json:"spotted_hero_sec,omitempty"` // 假眼：视野内敌方英雄累计秒数；真眼：范围内隐身敌方英雄累计秒数
+	SpottedHeroes  int32   `json:"spotted_heroes,omitempty"`   // 上述统计涉及的不同敌方英雄数
+	RevealedWards  int32   `json:"revealed_wards,omitempty"`   // 真眼：真视范围内同时存活的敌方眼数
+	// SpotID 所在的常用眼位（internal/spot 聚类目录中的 ID），不在任何眼位内为空
+	SpotID string `json:"spot_id,omitempty"`
+	// RoshanState 插眼时肉山是否存活（RoshanUp / RoshanDown），来自录像；OpenDota 数据为空
+	RoshanState string `json:"roshan_state,omitempty"`
 }
 
+// 眼位移除原因（WardRecord.RemovalCause）
+const (
+	RemovalExpired   = "expired"   // 存活满时长自然消失
+	RemovalDewarded  = "dewarded"  // 被敌方反掉
+	RemovalDenied    = "denied"    // 被己方反掉
+	RemovalGameEnd   = "game_end"  // 录像结束时仍存活
+	RemovalTruncated = "truncated" // 录像截断或损坏，解析中止时仍存活（持续时间为下界）
+	RemovalUnknown   = "unknown"   // 提前消失但战斗日志中找不到对应死亡
+)
+
+// 插眼时的肉山状态（WardRecord.RoshanState）
+const (
+	RoshanUp   = "up"
+	RoshanDown = "down"
+)
+
 // ObserverWardMaxDurationSec 观察者眼最大存活时间（秒）
 const ObserverWardMaxDurationSec = 360
 
 // SentryWardMaxDurationSec 岗哨眼最大存活时间（秒），以实际版本为准
 const SentryWardMaxDurationSec = 420
 
-// DurationRatio 计算单眼持续时间比例（0~1）
-func (w *WardRecord) DurationRatio() float64 {
-	max := ObserverWardMaxDurationSec
+// MaxDurationSec 该类型眼的理论最大存活时间（秒）
+func (w *WardRecord) MaxDurationSec() float64 {
 	if w.WardType == "sentry" {
-		max = SentryWardMaxDurationSec
+		return SentryWardMaxDurationSec
 	}
+	return ObserverWardMaxDurationSec
+}
+
+// DurationRatio 计算单眼持续时间比例（0~1）。AliveAtEnd 的眼为右删失数据，比例只是下界，
+// 聚合时应单独处理（如 Kaplan–Meier），不能当作被反。
+func (w *WardRecord) DurationRatio() float64 {
+	max := w.MaxDurationSec()
 	if max <= 0 {
 		return 0
 	}
-	r := w.DurationSec / float64(max)
+	r := w.DurationSec / max
 	if r > 1 {
 		return 1
 	}
@@ -0,0 +1,60 @@
+package parser
+
+import "github.com/dotabuff/manta"
+
+// preGameDurationSec 进入 DOTA_GAMERULES_STATE_PRE_GAME 到吹号角的固定时长（秒）
+const preGameDurationSec = 90
+
+// gameClock 跟踪 CDOTAGamerulesProxy 上的时间字段（cmd/debug_game_time 用于定位这些字段），
+// 把服务器时间换算为以号角为 0 点的游戏内时间，开局前为负值，与 OpenDota obs_log 的 time 一致。
+type gameClock struct {
+	gameTime         float64 // m_pGameRules.m_fGameTime，服务器时间（暂停时不走）
+	gameStartTime    float64 // m_pGameRules.m_flGameStartTime，号角时刻的服务器时间，未开始为 0
+	preGameStartTime float64 // m_pGameRules.m_flPreGameStartTime，进入 PRE_GAME 的服务器时间
+}
+
+// update 在 CDOTAGamerulesProxy 实体创建/更新时读取时间字段，其它实体直接忽略。
+func (c *gameClock) update(e *manta.Entity) {
+	if e.GetClassName() != "CDOTAGamerulesProxy" {
+		return
+	}
+	if v, ok := e.GetFloat32("m_pGameRules.m_fGameTime"); ok && v > 0 {
+		c.gameTime = float64(v)
+	}
+	if v, ok := e.GetFloat32("m_pGameRules.m_flGameStartTime"); ok && v > 0 {
+		c.gameStartTime = float64(v)
+	}
+	if v, ok := e.GetFloat32("m_pGameRules.m_flPreGameStartTime"); ok && v > 0 {
+		c.preGameStartTime = float64(v)
+	}
+}
+
+// serverTime 当前服务器时间；尚未收到 game rules 时退回 tick/30。
+func (c *gameClock) serverTime(tick uint32) float64 {
+	if c.gameTime > 0 {
+		return c.gameTime
+	}
+	return float64(tick) / ticksPerSecond
+}
+
+// hornTime 号角时刻的服务器时间。录像在号角前截断时用 PRE_GAME 开始时间 + 90 秒推算，
+// 两者都没有时返回 0（此时游戏内时间退化为服务器时间）。
+func (c *gameClock) hornTime() float64 {
+	if c.gameStartTime > 0 {
+		return c.gameStartTime
+	}
+	if c.preGameStartTime > 0 {
+		return c.preGameStartTime + preGameDurationSec
+	}
+	return 0
+}
+
+// started 服务器时间 serverTime 时是否已吹号角
+func (c *gameClock) started(serverTime float64) bool {
+	return c.gameStartTime > 0 && serverTime >= c.gameStartTime
+}
+
+// gameTimeSec 把服务器时间换算为游戏内时间（号角为 0，开局前为负）。
+func (c *gameClock) gameTimeSec(serverTime float64) float64 {
+	return serverTime - c.hornTime()
+}
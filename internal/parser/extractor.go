@@ -0,0 +1,424 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/cndotaplan/cndotaplan/internal/coord"
+	"github.com/cndotaplan/cndotaplan/internal/model"
+	"github.com/cndotaplan/cndotaplan/internal/region"
+	"github.com/dotabuff/manta"
+	"github.com/dotabuff/manta/dota"
+)
+
+// WardEventKind 眼位事件类型
+type WardEventKind string
+
+const (
+	WardPlaced  WardEventKind = "placed"  // 眼实体创建
+	WardUpdated WardEventKind = "updated" // 位置、队伍或插眼者有变化（创建时 CBodyComponent 可能尚未同步）
+	WardRemoved WardEventKind = "removed" // 眼被反/到期/录像结束，Ward 为最终记录
+)
+
+// WardEvent 解析过程中实时发出的眼位事件。
+// Ward 为事件发生时的快照：GameTimeSec 按当时已知的号角时刻换算，号角前插的眼在号角到来之前可能不准，
+// 以 Run 返回的记录为准；removed 事件在实体删除 removalMatchWindowTicks 后发出，以便带上战斗日志中的移除原因。
+type WardEvent struct {
+	Kind        WardEventKind    `json:"kind"`
+	Tick        uint32           `json:"tick"`
+	EntityIndex int32            `json:"entity_index"`
+	Ward        model.WardRecord `json:"ward"`
+}
+
+// Progress 解析进度
+type Progress struct {
+	Tick        uint32  `json:"tick"`
+	GameTimeSec float64 `json:"game_time_sec"`
+	Active      int     `json:"active"`   // 当前场上的眼
+	Finished    int     `json:"finished"` // 已移除的眼
+}
+
+// defaultProgressTicks 默认每 30 秒游戏时间报告一次进度
+const defaultProgressTicks = 30 * ticksPerSecond
+
+// WardExtractor 流式眼位提取：边解析边通过回调发出事件，可通过 context 中止。
+// 回调在解析 goroutine 中同步调用，耗时操作应自行转交其它 goroutine。
+type WardExtractor struct {
+	MatchID       int64
+	OnEvent       func(WardEvent)
+	OnProgress    func(Progress)
+	ProgressTicks uint32 // 进度回调间隔（tick），0 为 defaultProgressTicks
+	// HeroSampleSec 大于 0 时每隔这么多秒游戏时间记录全部英雄的位置与存活状态，结果在 Tracks
+	HeroSampleSec float64
+	// Info Run 返回后为录像中的比赛元数据；截断的录像没有末尾的 CDemoFileInfo，只有 match_id、时长等部分字段
+	Info model.MatchInfo
+	// Vision Run 返回后为眼位以外的视野事件（雾、粉、宝石、哨塔、扫描、双生门），按开始时间排序
+	Vision []model.VisionEvent
+	// Tracks Run 返回后为英雄位置采样（HeroSampleSec 为 0 时为空），按 player_slot 排序
+	Tracks []model.HeroTrack
+	// Trees Run 返回后为砍树（战斗日志的砍树记录）与临时树，按时间排序
+	Trees []model.TreeEvent
+
+	parser  *session
+	regions *region.Map
+	clock   *gameClock
+	match   *matchState
+	vision  *visionTracker
+	heroes  *heroSampler // HeroSampleSec 为 0 时为 nil
+	trees   *treeTracker
+	roshan  *roshanTracker
+	combat  *combatLog
+	// active：创建时登记，销毁时取出并统计持续时间，保证每条眼的 duration = 销毁 tick - 创建 tick
+	active map[int32]*pendingWard
+	// finished 按结束顺序记录已销毁/录像结束时仍存活的眼；号角时刻可能晚于眼的销毁（开局前被反），
+	// 因此最终的 WardRecord 在解析结束后统一生成
+	finished []*pendingWard
+	// removing 已删除但尚未发出 removed 事件的眼（等待战斗日志到达）
+	removing     []*pendingWard
+	lastProgress uint32
+	truncated    bool // 录像截断/损坏，finish 时仍存活的眼记为 RemovalTruncated
+}
+
+// NewWardExtractor 创建提取器；matchID 用于填充 WardRecord.MatchID，传 0 时取录像中的 match_id。
+func NewWardExtractor(matchID int64) *WardExtractor {
+	return &WardExtractor{MatchID: matchID}
+}
+
+// Run 从录像流 r 解析眼位，返回全部记录（与 ExtractWards 相同）。r 可以是未压缩的 .dem，
+// 也可以是 bzip2/gzip/zstd 压缩流，按魔数识别（见 Decompress）。
+// ctx 取消后在下一个 tick 停止解析并返回 ctx.Err()。
+// 录像截断或损坏时返回截至最后一个正常 tick 的记录和 *PartialError，调用方用 errors.As 判断是否接受部分结果。
+func (x *WardExtractor) Run(ctx context.Context, r io.Reader) ([]model.WardRecord, error) {
+	regions, err := region.Load("")
+	if err != nil {
+		return nil, fmt.Errorf("region.Load: %w", err)
+	}
+	dem, _, err := Decompress(ctxReader{ctx, r})
+	if err != nil {
+		return nil, err
+	}
+	defer dem.Close()
+	parser, err := manta.NewStreamParser(dem)
+	if err != nil {
+		return nil, fmt.Errorf("NewStreamParser: %w", err)
+	}
+	x.parser = &session{Parser: parser}
+	x.regions = regions
+	x.clock = &gameClock{}
+	x.match = &matchState{}
+	x.Info = model.MatchInfo{}
+	x.vision = newVisionTracker()
+	x.trees = newTreeTracker()
+	x.roshan = &roshanTracker{}
+	x.Vision, x.Tracks, x.Trees, x.heroes = nil, nil, nil, nil
+	if x.HeroSampleSec > 0 {
+		x.heroes = newHeroSampler(x.HeroSampleSec)
+	}
+	x.combat = &combatLog{}
+	x.active = make(map[int32]*pendingWard)
+	x.finished, x.removing, x.lastProgress, x.truncated = nil, nil, 0, false
+
+	parser.Callbacks.OnCMsgDOTACombatLogEntry(func(m *dota.CMsgDOTACombatLogEntry) error {
+		x.combat.onEntry(x.parser, m)
+		x.vision.onEntry(x.parser, x.clock, m)
+		x.trees.onEntry(x.parser, x.clock, m)
+		x.roshan.onEntry(x.parser, m)
+		if x.heroes != nil {
+			x.heroes.onEntry(x.parser, m)
+		}
+		return nil
+	})
+	parser.Callbacks.OnCDOTAUserMsg_SpectatorPlayerUnitOrders(func(m *dota.CDOTAUserMsg_SpectatorPlayerUnitOrders) error {
+		x.vision.onOrder(x.parser, x.clock, m)
+		return nil
+	})
+	parser.Callbacks.OnCNETMsg_Tick(func(*dota.CNETMsg_Tick) error {
+		if ctx.Err() != nil {
+			parser.Stop()
+			return nil
+		}
+		x.flushRemoved(false)
+		x.vision.sample(x.parser, x.clock)
+		if x.heroes != nil {
+			x.heroes.sample(x.parser, x.clock)
+		}
+		x.progress(false)
+		return nil
+	})
+	parser.Callbacks.OnCDemoFileHeader(func(m *dota.CDemoFileHeader) error {
+		x.match.onFileHeader(m)
+		return nil
+	})
+	parser.Callbacks.OnCDemoFileInfo(func(m *dota.CDemoFileInfo) error {
+		x.match.onFileInfo(m)
+		return nil
+	})
+	parser.OnEntity(x.onEntity)
+
+	stopped := false
+	parser.Callbacks.OnCDemoStop(func(*dota.CDemoStop) error {
+		stopped = true
+		return nil
+	})
+
+	err = parser.Start()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	// 完整录像以 CDemoStop 结尾；manta 在消息边界处遇到 EOF 时不报错，需自行判断是否截断
+	if err == nil && !stopped {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil && parser.NetTick == 0 {
+		// 一个 tick 都没解析出来，没有可用的部分结果
+		return nil, fmt.Errorf("parser.Start: %w", err)
+	}
+	if err != nil {
+		pe := &PartialError{LastTick: parser.NetTick, GameTimeSec: x.clock.gameTimeSec(x.clock.serverTime(parser.NetTick)), Err: err}
+		x.truncated = true
+		records := x.finish()
+		pe.Wards = len(records)
+		return records, pe
+	}
+	return x.finish(), nil
+}
+
+// PartialError 录像截断或损坏：解析在 LastTick 之后失败。与之一同返回的记录截至 LastTick，
+// 当时仍存活的眼 RemovalCause 为 model.RemovalTruncated，持续时间是下界。
+type PartialError struct {
+	LastTick    uint32  // 最后一个成功处理的 tick
+	GameTimeSec float64 // LastTick 对应的游戏内时间
+	Wards       int     // 随错误一同返回的记录数
+	Err         error   // 原因，如 io.ErrUnexpectedEOF、bzip2 数据错误、manta 解码 panic
+}
+
+func (e *PartialError) Error() string {
+	return fmt.Sprintf("parser: replay truncated or corrupt after tick %d (game time %.0fs, %d wards kept): %v",
+		e.LastTick, e.GameTimeSec, e.Wards, e.Err)
+}
+
+func (e *PartialError) Unwrap() error { return e.Err }
+
+func (x *WardExtractor) onEntity(e *manta.Entity, op manta.EntityOp) error {
+	x.parser.onEntity(e, op)
+	x.clock.update(e)
+	x.match.update(e)
+	x.vision.onEntity(x.parser, x.clock, e, op)
+	x.trees.onEntity(x.parser, x.clock, e, op)
+	x.roshan.onEntity(e, op)
+	className := e.GetClassName()
+	if className != "CDOTA_NPC_Observer_Ward" && className != "CDOTA_NPC_Sentry_Ward" {
+		return nil
+	}
+	p := x.parser
+
+	wardType := "observer"
+	if className == "CDOTA_NPC_Sentry_Ward" {
+		wardType = "sentry"
+	}
+
+	if op.Flag(manta.EntityOpCreated) {
+		px, py := getWardPosition(e)
+		tick := p.NetTick // 记录创建时刻 tick，仅在与销毁 tick 做差时用于计算持续时间
+		pw := &pendingWard{
+			Index:      e.GetIndex(),
+			TeamID:     getWardTeam(p, e),
+			WardType:   wardType,
+			PosX:       px,
+			PosY:       py,
+			StartTick:  tick,
+			ServerTime: x.clock.serverTime(tick),
+			Roshan:     x.roshan.state(x.clock.started(x.clock.serverTime(tick))),
+			Owner:      getWardOwner(p, e),
+		}
+		x.active[pw.Index] = pw
+		x.emit(WardPlaced, pw)
+		return nil
+	}
+
+	if op.Flag(manta.EntityOpUpdated) {
+		pw, ok := x.active[e.GetIndex()]
+		if !ok {
+			return nil
+		}
+		changed := false
+		if px, py := getWardPosition(e); (px != 0 || py != 0) && (px != pw.PosX || py != pw.PosY) {
+			pw.PosX, pw.PosY = px, py
+			changed = true
+		}
+		if t := getWardTeam(p, e); t != 0 && t != pw.TeamID {
+			pw.TeamID = t
+			changed = true
+		}
+		if !pw.Owner.known() {
+			if o := getWardOwner(p, e); o.known() {
+				pw.Owner = o
+				changed = true
+			}
+		}
+		if changed {
+			x.emit(WardUpdated, pw)
+		}
+		return nil
+	}
+
+	if op.Flag(manta.EntityOpDeleted) {
+		idx := e.GetIndex()
+		pw, ok := x.active[idx]
+		if !ok {
+			return nil
+		}
+		delete(x.active, idx)
+		if t := getWardTeam(p, e); t != 0 {
+			pw.TeamID = t
+		}
+		// 删除时再读一次坐标（创建时 CBodyComponent 可能尚未同步）
+		if px, py := getWardPosition(e); px != 0 || py != 0 {
+			pw.PosX, pw.PosY = px, py
+		}
+		pw.EndTick = p.NetTick
+		x.finished = append(x.finished, pw)
+		x.removing = append(x.removing, pw)
+	}
+	return nil
+}
+
+// flushRemoved 为删除已超过配对窗口的眼确定移除原因并发出 removed 事件；all 为 true 时不等窗口（录像结束）
+func (x *WardExtractor) flushRemoved(all bool) {
+	if len(x.removing) == 0 {
+		return
+	}
+	now := x.parser.NetTick
+	n := 0
+	for n < len(x.removing) && (all || x.removing[n].EndTick+removalMatchWindowTicks <= now) {
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	x.combat.applyRewards()
+	for _, pw := range x.removing[:n] {
+		if pw.Cause == "" {
+			x.combat.attributeWard(pw)
+		}
+		x.emit(WardRemoved, pw)
+	}
+	x.removing = x.removing[n:]
+}
+
+func (x *WardExtractor) progress(final bool) {
+	if x.OnProgress == nil {
+		return
+	}
+	every := x.ProgressTicks
+	if every == 0 {
+		every = defaultProgressTicks
+	}
+	tick := x.parser.NetTick
+	if !final && tick < x.lastProgress+every {
+		return
+	}
+	x.lastProgress = tick
+	x.OnProgress(Progress{
+		Tick:        tick,
+		GameTimeSec: x.clock.gameTimeSec(x.clock.serverTime(tick)),
+		Active:      len(x.active),
+		Finished:    len(x.finished),
+	})
+}
+
+func (x *WardExtractor) emit(kind WardEventKind, pw *pendingWard) {
+	if x.OnEvent == nil {
+		return
+	}
+	rec := x.record(pw)
+	if kind != WardRemoved {
+		// 尚未结束的眼：持续时间截至当前 tick
+		rec.DurationSec = tickSpanSec(pw.StartTick, x.parser.NetTick)
+	}
+	x.OnEvent(WardEvent{Kind: kind, Tick: x.parser.NetTick, EntityIndex: pw.Index, Ward: rec})
+}
+
+// finish 录像结束（或截断）：补写仍存活的眼，确定全部移除原因并生成最终记录
+func (x *WardExtractor) finish() []model.WardRecord {
+	x.Info = x.match.finish(x.clock, x.clock.serverTime(x.parser.NetTick))
+	if x.Info.MatchID == 0 {
+		x.Info.MatchID = x.MatchID
+	}
+	// 版本要到录像末尾才知道：区域表换成该版本的，此前发出的事件按最新版本打标
+	if x.Info.Patch != "" && x.Info.Patch != x.regions.Patch {
+		if regions, err := region.Load(x.Info.Patch); err == nil {
+			x.regions = regions
+		}
+	}
+	// 录像结束（拆塔/GG）时仍在场上的眼没有删除事件，按插眼顺序补写，持续时间截至最后一个 tick
+	remaining := make([]*pendingWard, 0, len(x.active))
+	for _, pw := range x.active {
+		remaining = append(remaining, pw)
+	}
+	sort.Slice(remaining, func(i, j int) bool { return remaining[i].StartTick < remaining[j].StartTick })
+	for _, pw := range remaining {
+		pw.EndTick = x.parser.NetTick
+		pw.AliveAtEnd = true
+		if x.truncated {
+			pw.Cause = model.RemovalTruncated
+		}
+		x.finished = append(x.finished, pw)
+		x.removing = append(x.removing, pw)
+	}
+	x.active = map[int32]*pendingWard{}
+	x.flushRemoved(true)
+	x.combat.attribute(x.finished)
+	x.progress(true)
+
+	result := make([]model.WardRecord, 0, len(x.finished))
+	for _, pw := range x.finished {
+		result = append(result, x.record(pw))
+	}
+	x.vision.finish(x.parser.NetTick)
+	x.Vision = make([]model.VisionEvent, 0, len(x.vision.events))
+	for _, pv := range x.vision.events {
+		x.Vision = append(x.Vision, pv.record(x.matchID(), x.clock, x.regions))
+	}
+	x.trees.finish(x.parser.NetTick)
+	x.Trees = make([]model.TreeEvent, 0, len(x.trees.events))
+	for _, pt := range x.trees.events {
+		x.Trees = append(x.Trees, pt.record(x.matchID(), x.clock))
+	}
+	if x.heroes != nil {
+		x.Tracks = x.heroes.result(x.matchID())
+	}
+	return result
+}
+
+func (x *WardExtractor) record(pw *pendingWard) model.WardRecord {
+	rec := pw.record(x.matchID(), x.clock)
+	rec.RegionTag = x.regions.TagIn(rec.PosX, rec.PosY, coord.World)
+	return rec
+}
+
+// matchID 调用方给定的 match_id 优先，否则取录像中的
+func (x *WardExtractor) matchID() int64 {
+	if x.MatchID != 0 {
+		return x.MatchID
+	}
+	return x.match.info.MatchID
+}
+
+// ctxReader 每次 Read 前检查 ctx，使阻塞在读取上的解析（如 HTTP 响应体）也能及时中止
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,109 @@
+package parser
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dotabuff/manta/dota"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrNoFileInfo 录像没有 CDemoFileInfo（截断或仍在写入）
+var ErrNoFileInfo = errors.New("parser: replay has no CDemoFileInfo")
+
+// demoHeaderSize PBDEMS2 魔数与其后两个 int32：CDemoFileInfo 的偏移与 spawn groups 的偏移
+const demoHeaderSize = 16
+
+// ReadFileInfo 按文件头中的偏移直接读录像末尾的 CDemoFileInfo，不解析录像正文，用于在解析前取 match_id。
+// 未压缩的录像直接跳到偏移处；压缩的录像需要解压到该处（只解压，不解析）。
+func ReadFileInfo(path string) (*dota.CDemoFileInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, format, err := Decompress(f)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var head [demoHeaderSize]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, fmt.Errorf("parser: read replay header: %w", err)
+	}
+	off := int64(binary.LittleEndian.Uint32(head[8:12]))
+	if off <= demoHeaderSize {
+		return nil, ErrNoFileInfo
+	}
+	var br *bufio.Reader
+	if format == FormatDem {
+		if _, err := f.Seek(off, io.SeekStart); err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(f)
+	} else {
+		if _, err := io.CopyN(io.Discard, r, off-demoHeaderSize); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, ErrNoFileInfo
+			}
+			return nil, err
+		}
+		br = bufio.NewReader(r)
+	}
+	return readFileInfoMessage(br)
+}
+
+// readFileInfoMessage 读一条外层消息（命令、tick、长度均为 varint），须为 DEM_FileInfo
+func readFileInfoMessage(r *bufio.Reader) (*dota.CDemoFileInfo, error) {
+	var v [3]uint64
+	for i := range v {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, ErrNoFileInfo
+			}
+			return nil, err
+		}
+		v[i] = n
+	}
+	cmd, size := dota.EDemoCommands(v[0]), v[2]
+	compressed := cmd&dota.EDemoCommands_DEM_IsCompressed != 0
+	if cmd &^= dota.EDemoCommands_DEM_IsCompressed; cmd != dota.EDemoCommands_DEM_FileInfo {
+		return nil, ErrNoFileInfo
+	}
+	if size > 16<<20 {
+		return nil, fmt.Errorf("parser: CDemoFileInfo of %d bytes", size)
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, ErrNoFileInfo
+	}
+	if compressed {
+		var err error
+		if buf, err = snappy.Decode(nil, buf); err != nil {
+			return nil, fmt.Errorf("parser: CDemoFileInfo: %w", err)
+		}
+	}
+	var info dota.CDemoFileInfo
+	if err := proto.Unmarshal(buf, &info); err != nil {
+		return nil, fmt.Errorf("parser: CDemoFileInfo: %w", err)
+	}
+	return &info, nil
+}
+
+// ReadMatchID 不解析录像，从 CDemoFileInfo 取 match_id；没有时返回 ErrNoFileInfo
+func ReadMatchID(path string) (int64, error) {
+	info, err := ReadFileInfo(path)
+	if err != nil {
+		return 0, err
+	}
+	if id := info.GetGameInfo().GetDota().GetMatchId(); id != 0 {
+		return int64(id), nil
+	}
+	return 0, ErrNoFileInfo
+}
@@ -0,0 +1,78 @@
+package parser
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dotabuff/manta/dota"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeDemo 只有文件头、一段占位正文与末尾 CDemoFileInfo 的录像
+func fakeDemo(t *testing.T, matchID uint64, compressed bool) []byte {
+	info := &dota.CDemoFileInfo{GameInfo: &dota.CGameInfo{Dota: &dota.CGameInfo_CDotaGameInfo{MatchId: proto.Uint64(matchID)}}}
+	msg, err := proto.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := uint64(dota.EDemoCommands_DEM_FileInfo)
+	if compressed {
+		msg = snappy.Encode(nil, msg)
+		cmd |= uint64(dota.EDemoCommands_DEM_IsCompressed)
+	}
+	body := bytes.Repeat([]byte{0xAB}, 1000)
+	var b bytes.Buffer
+	b.Write(magicDem)
+	binary.Write(&b, binary.LittleEndian, uint32(demoHeaderSize+len(body)))
+	binary.Write(&b, binary.LittleEndian, uint32(0))
+	b.Write(body)
+	b.Write(binary.AppendUvarint(nil, cmd))
+	b.Write(binary.AppendUvarint(nil, 12345))
+	b.Write(binary.AppendUvarint(nil, uint64(len(msg))))
+	b.Write(msg)
+	return b.Bytes()
+}
+
+func TestReadMatchID(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	gz := func(data []byte) []byte {
+		var b bytes.Buffer
+		zw := gzip.NewWriter(&b)
+		zw.Write(data)
+		zw.Close()
+		return b.Bytes()
+	}
+	raw := fakeDemo(t, 8100000001, true)
+	cases := []struct {
+		name string
+		data []byte
+		want int64
+		err  error
+	}{
+		{"a.dem", raw, 8100000001, nil},
+		{"b.dem", fakeDemo(t, 8100000002, false), 8100000002, nil},
+		{"c.dem.gz", gz(raw), 8100000001, nil},
+		// 截断：文件头的偏移超出文件
+		{"d.dem", raw[:600], 0, ErrNoFileInfo},
+		{"e.dem.gz", gz(raw[:600]), 0, ErrNoFileInfo},
+	}
+	for _, c := range cases {
+		got, err := ReadMatchID(write(c.name, c.data))
+		if got != c.want || (c.err == nil && err != nil) || (c.err != nil && !errors.Is(err, c.err)) {
+			t.Errorf("%s: ReadMatchID = %d, %v; want %d, %v", c.name, got, err, c.want, c.err)
+		}
+	}
+}
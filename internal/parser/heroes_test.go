@@ -0,0 +1,50 @@
+package parser
+
+import "testing"
+
+func TestHeroNpcName(t *testing.T) {
+	cases := map[int32]string{
+		1:   "npc_dota_hero_antimage",
+		11:  "npc_dota_hero_nevermore",
+		20:  "npc_dota_hero_vengefulspirit",
+		22:  "npc_dota_hero_zuus",
+		39:  "npc_dota_hero_queenofpain",
+		60:  "npc_dota_hero_night_stalker",
+		108: "npc_dota_hero_abyssal_underlord",
+		145: "npc_dota_hero_kez",
+		155: "npc_dota_hero_largo",
+		0:   "",
+		24:  "",
+	}
+	for id, want := range cases {
+		if got := heroNpcName(id); got != want {
+			t.Errorf("heroNpcName(%d) = %q, want %q", id, got, want)
+		}
+	}
+	// 黑暗飞升按单位名找夜魔
+	if heroNpcName(60) != heroNightStalker {
+		t.Errorf("heroNightStalker = %q is not hero 60", heroNightStalker)
+	}
+	seen := map[string]int32{}
+	for id, name := range heroNpcNames {
+		if other, ok := seen[name]; ok {
+			t.Errorf("%s listed for both %d and %d", name, other, id)
+		}
+		seen[name] = id
+	}
+}
+
+func TestHeroNameFromClass(t *testing.T) {
+	cases := map[string]string{
+		"CDOTA_Unit_Hero_Largo":     "npc_dota_hero_largo",
+		"CDOTA_Unit_Hero_ArcWarden": "npc_dota_hero_arc_warden",
+		"CDOTA_Unit_Hero_Kez":       "npc_dota_hero_kez",
+		"CDOTA_Unit_Hero_":          "",
+		"CDOTA_NPC_Observer_Ward":   "",
+	}
+	for class, want := range cases {
+		if got := heroNameFromClass(class); got != want {
+			t.Errorf("heroNameFromClass(%q) = %q, want %q", class, got, want)
+		}
+	}
+}
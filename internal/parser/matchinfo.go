@@ -0,0 +1,125 @@
+package parser
+
+import (
+	"time"
+
+	"github.com/cndotaplan/cndotaplan/internal/model"
+	"github.com/dotabuff/manta"
+	"github.com/dotabuff/manta/dota"
+)
+
+// patchReleases 各版本上线日期（UTC），按时间升序；只列大版本，字母小版本不影响地图与区域表。
+// 录像里只有服务器 build 号，没有版本字符串，因此按比赛日期推断版本。新版本上线后在此追加。
+var patchReleases = []struct {
+	Patch string
+	Date  time.Time
+}{
+	{"7.33", time.Date(2023, 4, 20, 0, 0, 0, 0, time.UTC)},
+	{"7.34", time.Date(2023, 8, 8, 0, 0, 0, 0, time.UTC)},
+	{"7.35", time.Date(2023, 12, 14, 0, 0, 0, 0, time.UTC)},
+	{"7.36", time.Date(2024, 5, 22, 0, 0, 0, 0, time.UTC)},
+	{"7.37", time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)},
+	{"7.38", time.Date(2025, 2, 19, 0, 0, 0, 0, time.UTC)},
+	{"7.39", time.Date(2025, 5, 22, 0, 0, 0, 0, time.UTC)},
+	{"7.40", time.Date(2025, 12, 15, 0, 0, 0, 0, time.UTC)},
+}
+
+// PatchAt 比赛时间 t 所在的版本；早于表中所有版本时返回空串
+func PatchAt(t time.Time) string {
+	patch := ""
+	for _, r := range patchReleases {
+		if t.Before(r.Date) {
+			break
+		}
+		patch = r.Patch
+	}
+	return patch
+}
+
+// matchState 解析过程中收集的比赛元数据；game rules 提供开局即可用的 match_id，
+// CDemoFileInfo 在录像末尾，提供战队、BP、胜方等，截断的录像可能没有。
+type matchState struct {
+	info        model.MatchInfo
+	gameEndTime float64 // m_pGameRules.m_flGameEndTime，服务器时间，未结束为 0
+	endTime     int64   // CDemoFileInfo.game_info.dota.end_time，Unix 秒
+}
+
+func (s *matchState) onFileHeader(m *dota.CDemoFileHeader) {
+	s.info.Build = m.GetBuildNum()
+}
+
+func (s *matchState) onFileInfo(m *dota.CDemoFileInfo) {
+	g := m.GetGameInfo().GetDota()
+	if g == nil {
+		return
+	}
+	info := &s.info
+	if id := g.GetMatchId(); id != 0 {
+		info.MatchID = int64(id)
+	}
+	if v := g.GetGameMode(); v != 0 {
+		info.GameMode = v
+	}
+	if v := g.GetGameWinner(); v != 0 {
+		info.Winner = v
+	}
+	info.LeagueID = int64(g.GetLeagueid())
+	info.RadiantTeam = model.TeamInfo{ID: int64(g.GetRadiantTeamId()), Tag: g.GetRadiantTeamTag()}
+	info.DireTeam = model.TeamInfo{ID: int64(g.GetDireTeamId()), Tag: g.GetDireTeamTag()}
+	s.endTime = int64(g.GetEndTime())
+
+	info.PicksBans = info.PicksBans[:0]
+	for i, pb := range g.GetPicksBans() {
+		info.PicksBans = append(info.PicksBans, model.PickBan{
+			Order:  i,
+			IsPick: pb.GetIsPick(),
+			TeamID: int32(pb.GetTeam()),
+			HeroID: pb.GetHeroId(),
+		})
+	}
+	info.Players = info.Players[:0]
+	for _, p := range g.GetPlayerInfo() {
+		pi := model.PlayerInfo{TeamID: p.GetGameTeam(), PlayerName: p.GetPlayerName(), HeroName: p.GetHeroName()}
+		if sid := p.GetSteamid(); sid > steamID64Base {
+			pi.AccountID = uint32(sid - steamID64Base)
+		}
+		info.Players = append(info.Players, pi)
+	}
+}
+
+// update 读取 CDOTAGamerulesProxy 上的比赛字段，其它实体直接忽略
+func (s *matchState) update(e *manta.Entity) {
+	if e.GetClassName() != "CDOTAGamerulesProxy" {
+		return
+	}
+	if v, ok := e.GetUint64("m_pGameRules.m_unMatchID64"); ok && v != 0 {
+		s.info.MatchID = int64(v)
+	}
+	if v, ok := e.GetInt32("m_pGameRules.m_iGameMode"); ok && v != 0 {
+		s.info.GameMode = v
+	}
+	if v, ok := e.GetInt32("m_pGameRules.m_nGameWinner"); ok && (v == teamRadiant || v == teamDire) {
+		s.info.Winner = v
+	}
+	if v, ok := e.GetFloat32("m_pGameRules.m_flGameEndTime"); ok && v > 0 {
+		s.gameEndTime = float64(v)
+	}
+}
+
+// finish 解析结束时补全时长、开始时间与版本。lastServerTime 为最后一个 tick 的服务器时间，
+// 比赛未正常结束（录像截断）时以它作为时长的下界。
+func (s *matchState) finish(clock *gameClock, lastServerTime float64) model.MatchInfo {
+	info := s.info
+	end := s.gameEndTime
+	if end <= 0 {
+		end = lastServerTime
+	}
+	if d := clock.gameTimeSec(end); d > 0 {
+		info.DurationSec = d
+	}
+	if s.endTime > 0 {
+		info.StartTime = s.endTime - int64(info.DurationSec)
+		info.Patch = PatchAt(time.Unix(info.StartTime, 0))
+	}
+	return info
+}
@@ -0,0 +1,47 @@
+package parser
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPatchAt(t *testing.T) {
+	cases := []struct {
+		t    time.Time
+		want string
+	}{
+		{time.Date(2023, 4, 19, 23, 59, 0, 0, time.UTC), ""},
+		{time.Date(2023, 4, 20, 0, 0, 0, 0, time.UTC), "7.33"},
+		{time.Date(2025, 5, 21, 12, 0, 0, 0, time.UTC), "7.38"},
+		{time.Date(2025, 5, 22, 0, 0, 0, 0, time.UTC), "7.39"},
+		{time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), "7.40"},
+	}
+	for _, c := range cases {
+		if got := PatchAt(c.t); got != c.want {
+			t.Errorf("PatchAt(%s) = %q, want %q", c.t.Format(time.RFC3339), got, c.want)
+		}
+	}
+	for i := 1; i < len(patchReleases); i++ {
+		if !patchReleases[i-1].Date.Before(patchReleases[i].Date) {
+			t.Errorf("patchReleases not ascending at %s", patchReleases[i].Patch)
+		}
+	}
+}
+
+func TestMatchFinishPatch(t *testing.T) {
+	// 号角在服务器时间 100 秒，比赛在 2100 秒结束：时长 2000 秒，开始时间由结束时间倒推
+	end := time.Date(2025, 5, 22, 0, 20, 0, 0, time.UTC)
+	s := matchState{gameEndTime: 2100, endTime: end.Unix()}
+	info := s.finish(&gameClock{gameStartTime: 100}, 2200)
+	if info.DurationSec != 2000 {
+		t.Errorf("duration %v, want 2000", info.DurationSec)
+	}
+	// 开始于 5 月 21 日 23:46，仍是 7.38
+	if info.Patch != "7.38" || info.StartTime != end.Unix()-2000 {
+		t.Errorf("patch %q start %d, want 7.38 from the start time", info.Patch, info.StartTime)
+	}
+	// 没有 CDemoFileInfo 的截断录像没有日期，版本未知
+	if info := (&matchState{}).finish(&gameClock{gameStartTime: 100}, 700); info.Patch != "" || info.DurationSec != 600 {
+		t.Errorf("truncated replay: patch %q duration %v, want unknown and 600", info.Patch, info.DurationSec)
+	}
+}
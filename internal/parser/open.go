@@ -0,0 +1,116 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Format 录像流的封装格式，按开头魔数识别，与文件名无关
+type Format string
+
+const (
+	FormatDem   Format = "dem"   // 未压缩的 Source 2 录像（PBDEMS2）
+	FormatBzip2 Format = "bzip2" // Valve CDN 下发的 .dem.bz2
+	FormatGzip  Format = "gzip"
+	FormatZstd  Format = "zstd"
+)
+
+var (
+	magicDem    = []byte("PBDEMS2\x00")
+	magicSource = []byte("HL2DEMO\x00") // Source 1 录像，manta 不支持
+	magicBzip2  = []byte("BZh")
+	magicGzip   = []byte{0x1f, 0x8b}
+	magicZstd   = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ErrUnknownFormat 无法识别的录像格式
+var ErrUnknownFormat = errors.New("parser: unknown replay format")
+
+// SniffFormat 根据开头若干字节判断格式
+func SniffFormat(head []byte) (Format, error) {
+	switch {
+	case bytes.HasPrefix(head, magicDem):
+		return FormatDem, nil
+	case bytes.HasPrefix(head, magicBzip2):
+		return FormatBzip2, nil
+	case bytes.HasPrefix(head, magicGzip):
+		return FormatGzip, nil
+	case bytes.HasPrefix(head, magicZstd):
+		return FormatZstd, nil
+	case bytes.HasPrefix(head, magicSource):
+		return "", fmt.Errorf("%w: Source 1 demo (HL2DEMO) is not supported", ErrUnknownFormat)
+	}
+	return "", ErrUnknownFormat
+}
+
+// Decompress 嗅探 r 的魔数并返回解压后的 PBDEMS2 流，可用于文件、HTTP 响应体、tar 条目或 stdin。
+// 返回的 ReadCloser 只释放解压器资源，不关闭 r。
+func Decompress(r io.Reader) (io.ReadCloser, Format, error) {
+	br := bufio.NewReaderSize(r, 64<<10)
+	head, err := br.Peek(len(magicDem))
+	if err != nil && !(errors.Is(err, io.EOF) && len(head) > 0) {
+		return nil, "", fmt.Errorf("parser: read replay header: %w", err)
+	}
+	format, err := SniffFormat(head)
+	if err != nil {
+		return nil, "", err
+	}
+	switch format {
+	case FormatBzip2:
+		return io.NopCloser(bzip2.NewReader(br)), format, nil
+	case FormatGzip:
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, format, fmt.Errorf("parser: gzip: %w", err)
+		}
+		return zr, format, nil
+	case FormatZstd:
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, format, fmt.Errorf("parser: zstd: %w", err)
+		}
+		return zr.IOReadCloser(), format, nil
+	}
+	return io.NopCloser(br), format, nil
+}
+
+// OpenReplay 打开录像文件并按内容自动解压；path 为 "-" 时读 stdin
+func OpenReplay(path string) (io.ReadCloser, error) {
+	var f *os.File
+	if path == "-" {
+		f = os.Stdin
+	} else {
+		var err error
+		if f, err = os.Open(path); err != nil {
+			return nil, err
+		}
+	}
+	r, _, err := Decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &replayFile{ReadCloser: r, f: f}, nil
+}
+
+// replayFile 关闭时同时关闭解压器与底层文件
+type replayFile struct {
+	io.ReadCloser
+	f *os.File
+}
+
+func (r *replayFile) Close() error {
+	err := r.ReadCloser.Close()
+	if ferr := r.f.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
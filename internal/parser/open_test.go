@@ -0,0 +1,106 @@
+package parser
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// demoPayload 解压后应得到的录像流
+var demoPayload = append(append([]byte(nil), magicDem...), "hello"...)
+
+// bzip2Payload demoPayload 经 bzip2 -9 压缩；标准库只有 bzip2 解压
+var bzip2Payload = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0xba, 0x4c,
+	0xaf, 0x77, 0x00, 0x00, 0x03, 0x4f, 0x00, 0x40, 0x00, 0x10, 0x00, 0x16,
+	0x02, 0x48, 0x00, 0x02, 0x44, 0xa0, 0x00, 0x22, 0x00, 0x68, 0xd0, 0x40,
+	0xd0, 0x34, 0x18, 0x09, 0xab, 0xec, 0x3a, 0x79, 0x3c, 0x5d, 0xc9, 0x14,
+	0xe1, 0x42, 0x42, 0xe9, 0x32, 0xbd, 0xdc,
+}
+
+func TestSniffFormat(t *testing.T) {
+	cases := []struct {
+		head []byte
+		want Format
+		err  bool
+	}{
+		{demoPayload, FormatDem, false},
+		{bzip2Payload, FormatBzip2, false},
+		{[]byte{0x1f, 0x8b, 0x08}, FormatGzip, false},
+		{[]byte{0x28, 0xb5, 0x2f, 0xfd, 0x00}, FormatZstd, false},
+		{[]byte("HL2DEMO\x00"), "", true},
+		{[]byte("PBDEMS"), "", true},
+		{nil, "", true},
+	}
+	for _, c := range cases {
+		got, err := SniffFormat(c.head)
+		if got != c.want || (err != nil) != c.err {
+			t.Errorf("SniffFormat(%q) = %q, %v; want %q", c.head, got, err, c.want)
+		}
+		if err != nil && !errors.Is(err, ErrUnknownFormat) {
+			t.Errorf("SniffFormat(%q): %v is not ErrUnknownFormat", c.head, err)
+		}
+	}
+	if _, err := SniffFormat([]byte("HL2DEMO\x00")); err == nil || !strings.Contains(err.Error(), "Source 1") {
+		t.Errorf("Source 1 demo: %v, want a Source 1 error", err)
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write(demoPayload)
+	gw.Close()
+	zw, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zst := zw.EncodeAll(demoPayload, nil)
+	zw.Close()
+
+	cases := map[Format][]byte{
+		FormatDem:   demoPayload,
+		FormatBzip2: bzip2Payload,
+		FormatGzip:  gz.Bytes(),
+		FormatZstd:  zst,
+	}
+	for want, data := range cases {
+		r, format, err := Decompress(bytes.NewReader(data))
+		if err != nil || format != want {
+			t.Errorf("%s: Decompress = %q, %v", want, format, err)
+			continue
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || !bytes.Equal(got, demoPayload) {
+			t.Errorf("%s: read %q, %v; want %q", want, got, err, demoPayload)
+		}
+	}
+	if _, _, err := Decompress(bytes.NewReader(nil)); err == nil {
+		t.Error("empty stream accepted")
+	}
+	if _, _, err := Decompress(strings.NewReader("not a replay")); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("unknown stream: %v, want ErrUnknownFormat", err)
+	}
+
+	// 文件名与内容无关：.dem 后缀的 zstd 文件也按内容解压
+	path := filepath.Join(t.TempDir(), "1.dem")
+	if err := os.WriteFile(path, zst, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := OpenReplay(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(f)
+	if err := f.Close(); err != nil || !bytes.Equal(got, demoPayload) {
+		t.Errorf("OpenReplay read %q, close %v", got, err)
+	}
+}
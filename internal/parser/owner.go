@@ -0,0 +1,102 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dotabuff/manta"
+)
+
+// steamID64Base SteamID64 与 32 位 account_id 的差值
+const steamID64Base = 76561197960265728
+
+// wardOwner 插眼玩家与英雄，来自 m_hOwnerEntity 指向的英雄实体和 CDOTA_PlayerResource
+type wardOwner struct {
+	PlayerID   int32 // 0-4 天辉，5-9 夜魇；-1 未知
+	AccountID  uint32
+	PlayerName string
+	HeroID     int32
+	HeroName   string // npc_dota_hero_xxx
+}
+
+// known 是否已解析出玩家
+func (o wardOwner) known() bool {
+	return o.PlayerID >= 0
+}
+
+// playerSlot 转为 OpenDota 的 player_slot（0-4 天辉，128-132 夜魇），未知为 -1
+func (o wardOwner) playerSlot() int32 {
+	switch {
+	case o.PlayerID < 0:
+		return -1
+	case o.PlayerID <= 4:
+		return o.PlayerID
+	default:
+		return 128 + o.PlayerID - 5
+	}
+}
+
+// getWardOwner 解析插眼者：先找拥有者英雄（m_hOwnerEntity → m_hOwnerNPC）取 m_iPlayerID，
+// 找不到英雄时用眼自身的 m_nPlayerOwnerID；再到 CDOTA_PlayerResource 读名字、Steam ID 与所选英雄。
+func getWardOwner(p *session, e *manta.Entity) wardOwner {
+	o := wardOwner{PlayerID: -1}
+	var hero *manta.Entity
+	for _, field := range []string{"m_hOwnerEntity", "m_hOwnerNPC"} {
+		if h := readHandleField(e, field); h != 0 {
+			if ent := p.FindEntityByHandle(h); ent != nil && isHeroEntity(ent) {
+				hero = ent
+				break
+			}
+		}
+	}
+	if hero != nil {
+		if pid, ok := hero.GetInt32("m_iPlayerID"); ok {
+			o.PlayerID = normalizePlayerID(pid)
+		}
+	}
+	if o.PlayerID < 0 {
+		if pid, ok := e.GetInt32("m_nPlayerOwnerID"); ok {
+			o.PlayerID = normalizePlayerID(pid)
+		}
+	}
+	if o.PlayerID < 0 {
+		return o
+	}
+	return playerOwner(p, o.PlayerID)
+}
+
+// playerOwner 由玩家 ID（0-9）到 CDOTA_PlayerResource 读名字、Steam ID 与所选英雄
+func playerOwner(p *session, playerID int32) wardOwner {
+	o := wardOwner{PlayerID: playerID}
+	if pr := findPlayerResource(p); pr != nil {
+		if name, ok := pr.GetString(fmt.Sprintf("m_vecPlayerData.%04d.m_iszPlayerName", o.PlayerID)); ok {
+			o.PlayerName = name
+		}
+		if sid, ok := pr.GetUint64(fmt.Sprintf("m_vecPlayerData.%04d.m_iPlayerSteamID", o.PlayerID)); ok && sid > steamID64Base {
+			o.AccountID = uint32(sid - steamID64Base)
+		}
+		if id, ok := pr.GetInt32(fmt.Sprintf("m_vecPlayerTeamData.%04d.m_nSelectedHeroID", o.PlayerID)); ok && id > 0 {
+			o.HeroID = id
+		}
+	}
+	o.HeroName = playerHeroName(p, o.PlayerID, o.HeroID)
+	return o
+}
+
+// normalizePlayerID 把实体上的玩家 ID 规整到 0-9；部分录像 m_nPlayerOwnerID 为 16 等，取低 4 位。
+// 超出范围返回 -1。
+func normalizePlayerID(pid int32) int32 {
+	if pid > 9 {
+		pid = pid & 0xF
+	}
+	if pid < 0 || pid > 9 {
+		return -1
+	}
+	return pid
+}
+
+const heroClassPrefix = "CDOTA_Unit_Hero_"
+
+func isHeroEntity(e *manta.Entity) bool {
+	return strings.HasPrefix(e.GetClassName(), heroClassPrefix)
+}
@@ -0,0 +1,151 @@
+package parser
+
+import (
+	"github.com/cndotaplan/cndotaplan/internal/model"
+	"github.com/dotabuff/manta/dota"
+)
+
+const (
+	// removalMatchWindowTicks 战斗日志死亡事件与实体删除之间允许的最大 tick 差（两者不保证同 tick 到达）
+	removalMatchWindowTicks = 60
+	// goldReasonWardKill EDOTA_ModifyGold_Reason 中「击杀守卫」的取值
+	goldReasonWardKill = 20
+	// xpReasonUnspecified EDOTA_ModifyXP_Reason 未细分的取值，击杀守卫的经验落在此类
+	xpReasonUnspecified = 0
+)
+
+// combatLogWardNames 战斗日志中眼位单位名 → WardType
+var combatLogWardNames = map[string]string{
+	"npc_dota_observer_wards": "observer",
+	"npc_dota_sentry_wards":   "sentry",
+}
+
+// wardDeath 战斗日志中的一次眼位死亡（DOTA_COMBATLOG_DEATH）
+type wardDeath struct {
+	Tick         uint32
+	WardType     string
+	TargetTeam   int32
+	AttackerName string // npc_dota_hero_xxx 或小兵/建筑等单位名
+	AttackerTeam int32
+	AttackerHero bool
+	Gold         int32
+	XP           int32
+	matched      bool
+}
+
+// combatReward 战斗日志中的金钱/经验获得，用于给 wardDeath 补上赏金
+type combatReward struct {
+	Tick     uint32
+	Receiver string
+	Gold     int32
+	XP       int32
+	used     bool
+}
+
+// combatLog 收集与眼位相关的战斗日志，解析结束后与眼实体删除配对，得出移除原因与击杀者。
+type combatLog struct {
+	deaths  []*wardDeath
+	rewards []*combatReward
+}
+
+// onEntry 处理一条战斗日志（CMsgDOTACombatLogEntry，HLTV 录像中逐条下发）
+func (c *combatLog) onEntry(p *session, m *dota.CMsgDOTACombatLogEntry) {
+	name := func(i uint32) string {
+		s, _ := p.LookupStringByIndex("CombatLogNames", int32(i))
+		return s
+	}
+	switch m.GetType() {
+	case dota.DOTA_COMBATLOG_TYPES_DOTA_COMBATLOG_DEATH:
+		wardType, ok := combatLogWardNames[name(m.GetTargetName())]
+		if !ok {
+			return
+		}
+		c.deaths = append(c.deaths, &wardDeath{
+			Tick:         p.NetTick,
+			WardType:     wardType,
+			TargetTeam:   int32(m.GetTargetTeam()),
+			AttackerName: name(m.GetAttackerName()),
+			AttackerTeam: int32(m.GetAttackerTeam()),
+			AttackerHero: m.GetIsAttackerHero(),
+		})
+	case dota.DOTA_COMBATLOG_TYPES_DOTA_COMBATLOG_GOLD:
+		if m.GetGoldReason() != goldReasonWardKill {
+			return
+		}
+		c.rewards = append(c.rewards, &combatReward{Tick: p.NetTick, Receiver: name(m.GetTargetName()), Gold: int32(m.GetValue())})
+	case dota.DOTA_COMBATLOG_TYPES_DOTA_COMBATLOG_XP:
+		if m.GetXpReason() != xpReasonUnspecified {
+			return
+		}
+		c.rewards = append(c.rewards, &combatReward{Tick: p.NetTick, Receiver: name(m.GetTargetName()), XP: int32(m.GetValue())})
+	}
+}
+
+// attribute 为已结束的眼确定移除原因，见 attributeWard。
+func (c *combatLog) attribute(wards []*pendingWard) {
+	c.applyRewards()
+	for _, pw := range wards {
+		if pw.Cause == "" {
+			c.attributeWard(pw)
+		}
+	}
+}
+
+// applyRewards 把尚未配对的赏金/经验记到最近的同一击杀者的死亡事件上；
+// 对应的死亡事件尚未到达时保留，下次调用再配对（流式解析时会多次调用）。
+func (c *combatLog) applyRewards() {
+	for _, r := range c.rewards {
+		if r.used {
+			continue
+		}
+		if d := c.nearestDeath(r.Tick, func(d *wardDeath) bool { return d.AttackerName == r.Receiver }); d != nil {
+			d.Gold += r.Gold
+			d.XP += r.XP
+			r.used = true
+		}
+	}
+}
+
+// attributeWard 有配对死亡事件时按击杀方队伍区分被反/自反，否则存活满时长视为自然到期，
+// 录像结束时仍存活为 game_end，其余为 unknown。
+func (c *combatLog) attributeWard(pw *pendingWard) {
+	if pw.AliveAtEnd {
+		pw.Cause = model.RemovalGameEnd
+		return
+	}
+	d := c.nearestDeath(pw.EndTick, func(d *wardDeath) bool {
+		return !d.matched && d.WardType == pw.WardType && (d.TargetTeam == 0 || pw.TeamID == 0 || d.TargetTeam == pw.TeamID)
+	})
+	expired := pw.durationSec() >= pw.maxDurationSec()-5
+	switch {
+	case expired && (d == nil || d.AttackerTeam == pw.TeamID):
+		// 到期消失时可能伴随一条本方单位的死亡日志，不能算作自反
+		pw.Cause = model.RemovalExpired
+	case d == nil:
+		pw.Cause = model.RemovalUnknown
+	case d.AttackerTeam != 0 && d.AttackerTeam == pw.TeamID:
+		pw.Cause = model.RemovalDenied
+	default:
+		pw.Cause = model.RemovalDewarded
+	}
+	if d != nil && pw.Cause != model.RemovalExpired {
+		d.matched = true
+		pw.Death = d
+	}
+}
+
+// nearestDeath 在 removalMatchWindowTicks 内找 tick 最接近且满足 ok 的死亡事件
+func (c *combatLog) nearestDeath(tick uint32, ok func(*wardDeath) bool) *wardDeath {
+	var best *wardDeath
+	bestDiff := uint32(removalMatchWindowTicks + 1)
+	for _, d := range c.deaths {
+		diff := d.Tick - tick
+		if tick > d.Tick {
+			diff = tick - d.Tick
+		}
+		if diff < bestDiff && ok(d) {
+			best, bestDiff = d, diff
+		}
+	}
+	return best
+}
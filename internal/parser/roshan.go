@@ -0,0 +1,56 @@
+package parser
+
+import (
+	"github.com/cndotaplan/cndotaplan/internal/model"
+	"github.com/dotabuff/manta"
+	"github.com/dotabuff/manta/dota"
+)
+
+// roshanClass 肉山实体
+const roshanClass = "CDOTA_Unit_Roshan"
+
+// roshanUnitName 战斗日志中的肉山单位名
+const roshanUnitName = "npc_dota_roshan"
+
+// roshanTracker 按肉山实体的存在与 m_lifeState 跟踪肉山是否存活，插眼时记下当时的状态。
+// 实体第一次出现前按战斗日志：号角后肉山即在坑中，第一次肉山死亡之前视为存活
+type roshanTracker struct {
+	seen   bool // 录像中出现过肉山实体
+	alive  bool
+	killed bool // 战斗日志中出现过肉山死亡
+}
+
+func (r *roshanTracker) onEntity(e *manta.Entity, op manta.EntityOp) {
+	if e.GetClassName() != roshanClass {
+		return
+	}
+	r.seen = true
+	if op.Flag(manta.EntityOpDeleted) {
+		r.alive = false
+		return
+	}
+	r.alive = heroAlive(e)
+}
+
+// onEntry 战斗日志中的肉山死亡
+func (r *roshanTracker) onEntry(p *session, m *dota.CMsgDOTACombatLogEntry) {
+	if m.GetType() != dota.DOTA_COMBATLOG_TYPES_DOTA_COMBATLOG_DEATH {
+		return
+	}
+	if name, _ := p.LookupStringByIndex("CombatLogNames", int32(m.GetTargetName())); name == roshanUnitName {
+		r.killed = true
+	}
+}
+
+// state model.RoshanUp / model.RoshanDown；实体出现前、号角前（started 为 false）未知为空
+func (r *roshanTracker) state(started bool) string {
+	switch {
+	case r.seen && r.alive:
+		return model.RoshanUp
+	case r.seen || r.killed:
+		return model.RoshanDown
+	case started:
+		return model.RoshanUp
+	}
+	return ""
+}
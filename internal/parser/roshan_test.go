@@ -0,0 +1,29 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/cndotaplan/cndotaplan/internal/model"
+)
+
+func TestRoshanState(t *testing.T) {
+	var r roshanTracker
+	if s := r.state(false); s != "" {
+		t.Errorf("before the horn: %q, want unknown", s)
+	}
+	if s := r.state(true); s != model.RoshanUp {
+		t.Errorf("after the horn, entity not seen: %q, want up", s)
+	}
+	r.killed = true
+	if s := r.state(true); s != model.RoshanDown {
+		t.Errorf("after a combat log death: %q, want down", s)
+	}
+	r = roshanTracker{seen: true, alive: true, killed: true}
+	if s := r.state(true); s != model.RoshanUp {
+		t.Errorf("respawned entity: %q, want up", s)
+	}
+	r.alive = false
+	if s := r.state(false); s != model.RoshanDown {
+		t.Errorf("dead entity: %q, want down", s)
+	}
+}
@@ -0,0 +1,133 @@
+package parser
+
+import (
+	"math"
+	"sort"
+
+	"github.com/cndotaplan/cndotaplan/internal/model"
+	"github.com/dotabuff/manta"
+	"github.com/dotabuff/manta/dota"
+)
+
+// heroSampler 每 interval 秒游戏时间记录一次全部英雄的位置与存活状态。
+// 采样时刻取 interval 的整数倍（号角为 0），暂停期间游戏时间不走，不会重复采样；
+// 进入 PRE_GAME 之前号角时刻未知，游戏时间不可靠，不采样。
+type heroSampler struct {
+	interval float64
+	next     float64
+	started  bool
+	tracks   map[int32]*model.HeroTrack // 玩家 ID（0-9）→ 轨迹
+	// invisible 英雄名 → 身上的隐身类状态（战斗日志 invisibility_modifier）及其层数
+	invisible map[string]map[string]int
+}
+
+func newHeroSampler(intervalSec float64) *heroSampler {
+	return &heroSampler{interval: intervalSec, tracks: map[int32]*model.HeroTrack{}, invisible: map[string]map[string]int{}}
+}
+
+// onEntry 从战斗日志跟踪英雄身上的隐身类状态
+func (s *heroSampler) onEntry(p *session, m *dota.CMsgDOTACombatLogEntry) {
+	typ := m.GetType()
+	if typ != dota.DOTA_COMBATLOG_TYPES_DOTA_COMBATLOG_MODIFIER_ADD && typ != dota.DOTA_COMBATLOG_TYPES_DOTA_COMBATLOG_MODIFIER_REMOVE {
+		return
+	}
+	if !m.GetIsTargetHero() || m.GetIsTargetIllusion() {
+		return
+	}
+	target, _ := p.LookupStringByIndex("CombatLogNames", int32(m.GetTargetName()))
+	modifier, _ := p.LookupStringByIndex("CombatLogNames", int32(m.GetInflictorName()))
+	mods := s.invisible[target]
+	if typ == dota.DOTA_COMBATLOG_TYPES_DOTA_COMBATLOG_MODIFIER_ADD {
+		if !m.GetInvisibilityModifier() {
+			return
+		}
+		if mods == nil {
+			mods = map[string]int{}
+			s.invisible[target] = mods
+		}
+		mods[modifier]++
+		return
+	}
+	if mods[modifier] > 1 {
+		mods[modifier]--
+	} else {
+		delete(mods, modifier)
+	}
+}
+
+// sample 在每个 tick 调用，到达下一个采样时刻时记录
+func (s *heroSampler) sample(p *session, clock *gameClock) {
+	if clock.hornTime() == 0 {
+		return
+	}
+	now := clock.gameTimeSec(clock.serverTime(p.NetTick))
+	if !s.started {
+		s.next = math.Ceil(now/s.interval) * s.interval
+		s.started = true
+	}
+	if now < s.next {
+		return
+	}
+	// 一个 tick 跨过多个采样时刻（号角时刻修正等）时只采最近的一个，中间的由 appendAt 补齐
+	at := math.Floor(now/s.interval) * s.interval
+	s.next = at + s.interval
+
+	for pid := int32(0); pid < 10; pid++ {
+		hero := selectedHero(p, pid)
+		t := s.tracks[pid]
+		if hero == nil {
+			if t != nil {
+				// 英雄暂时取不到（换英雄等）：沿用上一个位置，记为死亡
+				x, y, _ := t.At(t.Len() - 1)
+				s.appendAt(t, at, x, y, false, false)
+			}
+			continue
+		}
+		if t == nil {
+			o := playerOwner(p, pid)
+			t = &model.HeroTrack{
+				PlayerSlot:  o.playerSlot(),
+				TeamID:      readTeamNum(hero),
+				HeroName:    o.HeroName,
+				StartSec:    at,
+				IntervalSec: s.interval,
+			}
+			s.tracks[pid] = t
+		}
+		x, y := getWardPosition(hero)
+		s.appendAt(t, at, x, y, heroAlive(hero), len(s.invisible[t.HeroName]) > 0)
+	}
+}
+
+// appendAt 追加时刻 at 的采样；轨迹中间缺的采样（跳时）用当前值补齐，保证下标与时间一一对应
+func (s *heroSampler) appendAt(t *model.HeroTrack, at, x, y float64, alive, invisible bool) {
+	if at < t.TimeAt(t.Len())-s.interval/2 {
+		return // 游戏时间回退（号角时刻修正），该时刻已有采样
+	}
+	for t.TimeAt(t.Len()) < at-s.interval/2 {
+		t.Append(x, y, alive, invisible)
+	}
+	t.Append(x, y, alive, invisible)
+}
+
+// result 按 player_slot 排序的轨迹
+func (s *heroSampler) result(matchID int64) []model.HeroTrack {
+	out := make([]model.HeroTrack, 0, len(s.tracks))
+	for _, t := range s.tracks {
+		t.MatchID = matchID
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].PlayerSlot < out[j].PlayerSlot })
+	return out
+}
+
+// heroAlive m_lifeState 为 0 表示存活
+func heroAlive(hero *manta.Entity) bool {
+	if v, ok := hero.GetInt32("m_lifeState"); ok {
+		return v == 0
+	}
+	if v, ok := hero.GetUint32("m_lifeState"); ok {
+		return v == 0
+	}
+	return true
+}
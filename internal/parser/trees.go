@@ -0,0 +1,258 @@
+package parser
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+
+	"github.com/cndotaplan/cndotaplan/internal/coord"
+	"github.com/cndotaplan/cndotaplan/internal/model"
+	"github.com/cndotaplan/cndotaplan/internal/terrain"
+	"github.com/dotabuff/manta"
+	"github.com/dotabuff/manta/dota"
+)
+
+// tempTreeSuffix 种下的临时树实体（CDOTA_TempTree），存在期间与地图树一样挡视野
+const tempTreeSuffix = "TempTree"
+
+// 地图树状态位图：CDOTA_Data* 实体上的 m_bWorldTreeState（uint64[256]），每位一棵地图树。
+// 优先取观战数据（全图视野），没有时取第一个带该字段的队伍数据
+const (
+	treeStateClass  = "CDOTA_DataSpectator"
+	treeStatePrefix = "CDOTA_Data"
+	treeStateWords  = 256
+)
+
+// treeStateFields m_bWorldTreeState.0000 … .0255
+var treeStateFields = func() []string {
+	out := make([]string, treeStateWords)
+	for i := range out {
+		out[i] = fmt.Sprintf("m_bWorldTreeState.%04d", i)
+	}
+	return out
+}()
+
+// treeMatchTicks 战斗日志的砍树记录与状态位变化对应的最大 tick 差（约 2 秒）
+const treeMatchTicks = 2 * ticksPerSecond
+
+// pendingTree 解析中的树变化；砍树的 bit 为对应的状态位，未对应上为 -1
+type pendingTree struct {
+	ev         model.TreeEvent
+	owner      wardOwner
+	serverTime float64
+	startTick  uint32
+	endTick    uint32
+	bit        int
+	regrown    bool // 砍树：已从状态位读到长回（或录像结束时仍未长回）
+}
+
+// treeFlip 刚变为被砍的状态位，等待对应战斗日志的砍树记录
+type treeFlip struct {
+	bit  int
+	tick uint32
+}
+
+// treeTracker 从战斗日志的砍树记录跟踪被摧毁的地图树，从树状态位图读出它们何时长回；从实体跟踪种下的临时树。
+// 状态位图第一次出现时的值视为全部树都在（录像从开局开始），之后与它不同的位为被砍的树。
+// 砍树记录有位置没有树编号，状态位有编号没有位置，两者按 tick 先后一一对应；同一 tick 砍下的多棵树
+// 按顺序对应，它们的长回时间通常相同。
+type treeTracker struct {
+	events  []*pendingTree
+	planted map[int32]*pendingTree // 临时树实体 index → 事件
+
+	stateEntity int32    // 读取状态位图的实体 index，未选定为 -1
+	initial     []uint64 // 第一次读到的状态位图
+	state       []uint64
+	cut         map[int]*pendingTree // 状态位 → 尚未长回的砍树
+	flips       []treeFlip           // 刚被砍、还没有对应砍树记录的状态位
+	unmatched   []*pendingTree       // 还没有对应状态位的砍树记录
+}
+
+func newTreeTracker() *treeTracker {
+	return &treeTracker{planted: map[int32]*pendingTree{}, stateEntity: -1, cut: map[int]*pendingTree{}}
+}
+
+// onEntry 战斗日志的砍树记录（DOTA_COMBATLOG_TREE_CUT）：每条是一棵被摧毁的地图树，位置为树的坐标
+// （以地图中心为原点）。砍树者与物品/技能可能为空，此时队伍与玩家未知；没有位置的记录无法对应到树，跳过
+func (t *treeTracker) onEntry(p *session, clock *gameClock, m *dota.CMsgDOTACombatLogEntry) {
+	if m.GetType() != dota.DOTA_COMBATLOG_TYPES_DOTA_COMBATLOG_TREE_CUT {
+		return
+	}
+	x, y := m.GetLocationX(), m.GetLocationY()
+	if x == 0 && y == 0 {
+		return
+	}
+	cause, _ := p.LookupStringByIndex("CombatLogNames", int32(m.GetInflictorName()))
+	pt := &pendingTree{
+		ev: model.TreeEvent{
+			Kind:   model.TreeCut,
+			Cause:  cause,
+			PosX:   float64(x) + terrain.MapOffset,
+			PosY:   float64(y) + terrain.MapOffset,
+			Radius: terrain.DefaultTreeRadius,
+		},
+		owner:      wardOwner{PlayerID: -1},
+		serverTime: clock.serverTime(p.NetTick),
+		startTick:  p.NetTick,
+		bit:        -1,
+	}
+	// 同一 tick 内同一棵树的重复记录
+	if n := len(t.events); n > 0 {
+		if last := t.events[n-1]; last.ev.Kind == model.TreeCut && last.serverTime == pt.serverTime &&
+			last.ev.PosX == pt.ev.PosX && last.ev.PosY == pt.ev.PosY {
+			return
+		}
+	}
+	if !m.GetIsAttackerIllusion() {
+		user, _ := p.LookupStringByIndex("CombatLogNames", int32(m.GetAttackerName()))
+		if hero, pid := heroByName(p, user); hero != nil {
+			pt.ev.TeamID = readTeamNum(hero)
+			pt.owner = playerOwner(p, pid)
+		}
+	}
+	t.events = append(t.events, pt)
+	t.unmatched = append(t.unmatched, pt)
+	t.match(p.NetTick)
+}
+
+// onEntity 临时树的创建与删除，以及树状态位图的变化
+func (t *treeTracker) onEntity(p *session, clock *gameClock, e *manta.Entity, op manta.EntityOp) {
+	if strings.HasPrefix(e.GetClassName(), treeStatePrefix) {
+		t.onState(p.NetTick, e, op)
+		return
+	}
+	if !strings.HasSuffix(e.GetClassName(), tempTreeSuffix) {
+		return
+	}
+	idx := e.GetIndex()
+	if op.Flag(manta.EntityOpDeleted) {
+		if pt := t.planted[idx]; pt != nil {
+			pt.endTick = p.NetTick
+			delete(t.planted, idx)
+		}
+		return
+	}
+	if !op.Flag(manta.EntityOpCreated) {
+		return
+	}
+	pt := &pendingTree{
+		ev:         model.TreeEvent{Kind: model.TreePlanted, Cause: e.GetClassName()},
+		owner:      wardOwner{PlayerID: -1},
+		serverTime: clock.serverTime(p.NetTick),
+		startTick:  p.NetTick,
+		endTick:    p.NetTick,
+	}
+	pt.ev.PosX, pt.ev.PosY = getWardPosition(e)
+	t.planted[idx] = pt
+	t.events = append(t.events, pt)
+}
+
+// onState 从选定的实体读取状态位图
+func (t *treeTracker) onState(tick uint32, e *manta.Entity, op manta.EntityOp) {
+	idx := e.GetIndex()
+	if op.Flag(manta.EntityOpDeleted) {
+		if idx == t.stateEntity {
+			t.stateEntity = -1
+		}
+		return
+	}
+	switch {
+	case idx == t.stateEntity:
+	case t.stateEntity < 0 || e.GetClassName() == treeStateClass:
+		if _, ok := e.GetUint64(treeStateFields[0]); !ok {
+			return
+		}
+		t.stateEntity = idx
+	default:
+		return
+	}
+	state := make([]uint64, treeStateWords)
+	for i, f := range treeStateFields {
+		state[i], _ = e.GetUint64(f)
+	}
+	t.update(tick, state)
+}
+
+// update 与上次不同的位为被砍或长回的树
+func (t *treeTracker) update(tick uint32, state []uint64) {
+	if t.initial == nil {
+		t.initial, t.state = state, state
+		return
+	}
+	for i, w := range state {
+		changed := w ^ t.state[i]
+		for changed != 0 {
+			b := bits.TrailingZeros64(changed)
+			changed &^= 1 << b
+			bit := i*64 + b
+			if (w^t.initial[i])&(1<<b) != 0 {
+				t.flips = append(t.flips, treeFlip{bit: bit, tick: tick})
+				continue
+			}
+			// 长回：对应的砍树结束；还没对应上的直接丢弃
+			if pt := t.cut[bit]; pt != nil {
+				pt.endTick, pt.regrown = tick, true
+				delete(t.cut, bit)
+				continue
+			}
+			for k, f := range t.flips {
+				if f.bit == bit {
+					t.flips = append(t.flips[:k], t.flips[k+1:]...)
+					break
+				}
+			}
+		}
+	}
+	t.state = state
+	t.match(tick)
+}
+
+// match 按先后把砍树记录与刚被砍的状态位一一对应，超过 treeMatchTicks 仍对应不上的丢弃
+func (t *treeTracker) match(tick uint32) {
+	for len(t.flips) > 0 && len(t.unmatched) > 0 {
+		f, pt := t.flips[0], t.unmatched[0]
+		switch {
+		case f.tick+treeMatchTicks < pt.startTick:
+			t.flips = t.flips[1:]
+		case pt.startTick+treeMatchTicks < f.tick:
+			t.unmatched = t.unmatched[1:]
+		default:
+			pt.bit = f.bit
+			t.cut[f.bit] = pt
+			t.flips, t.unmatched = t.flips[1:], t.unmatched[1:]
+		}
+	}
+	for len(t.flips) > 0 && t.flips[0].tick+treeMatchTicks < tick {
+		t.flips = t.flips[1:]
+	}
+	for len(t.unmatched) > 0 && t.unmatched[0].startTick+treeMatchTicks < tick {
+		t.unmatched = t.unmatched[1:]
+	}
+}
+
+// finish 录像结束时仍在的临时树、仍未长回的砍树截至最后一个 tick
+func (t *treeTracker) finish(endTick uint32) {
+	for _, pt := range t.planted {
+		pt.endTick = endTick
+	}
+	for _, pt := range t.cut {
+		pt.endTick, pt.regrown = endTick, true
+	}
+}
+
+func (pt *pendingTree) record(matchID int64, clock *gameClock) model.TreeEvent {
+	ev := pt.ev
+	ev.MatchID = matchID
+	ev.PlayerSlot = pt.owner.playerSlot()
+	ev.HeroName = pt.owner.HeroName
+	ev.CoordSpace = string(coord.World)
+	ev.GameTimeSec = clock.gameTimeSec(pt.serverTime)
+	switch {
+	case ev.Kind == model.TreePlanted || pt.regrown:
+		ev.DurationSec = tickSpanSec(pt.startTick, pt.endTick)
+	default:
+		// 录像没有树状态位图，或砍树记录没有对应上状态位：按默认长回时间
+		ev.DurationSec = model.TreeRegrowSec
+	}
+	return ev
+}
@@ -0,0 +1,68 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/cndotaplan/cndotaplan/internal/model"
+)
+
+// cutAt 一条砍树记录
+func (t *treeTracker) cutAt(tick uint32) *pendingTree {
+	pt := &pendingTree{ev: model.TreeEvent{Kind: model.TreeCut}, startTick: tick, bit: -1}
+	t.events = append(t.events, pt)
+	t.unmatched = append(t.unmatched, pt)
+	t.match(tick)
+	return pt
+}
+
+func TestTreeRegrowth(t *testing.T) {
+	tr := newTreeTracker()
+	// 开局全部树都在：该位图中站着的树为 1
+	state := make([]uint64, treeStateWords)
+	state[0], state[3] = ^uint64(0), ^uint64(0)
+	tr.update(0, state)
+	set := func(tick uint32, word, bit int, standing bool) {
+		next := append([]uint64(nil), tr.state...)
+		if standing {
+			next[word] |= 1 << bit
+		} else {
+			next[word] &^= 1 << bit
+		}
+		tr.update(tick, next)
+	}
+
+	// 砍树记录先到、状态位后到
+	a := tr.cutAt(1000)
+	set(1001, 0, 5, false)
+	// 状态位先到、砍树记录后到
+	set(2000, 3, 1, false)
+	b := tr.cutAt(2002)
+	// 对应不上的砍树记录（状态位在 10 秒后才变）
+	c := tr.cutAt(3000)
+	set(3300, 0, 7, false)
+	// 还没长回的树
+	d := tr.cutAt(4000)
+	set(4000, 3, 9, false)
+
+	set(1000+240*ticksPerSecond, 0, 5, true)
+	set(2000+330*ticksPerSecond, 3, 1, true)
+	tr.finish(4000 + 60*ticksPerSecond)
+
+	if a.bit != 5 || b.bit != 3*64+1 || c.bit != -1 || d.bit != 3*64+9 {
+		t.Fatalf("bits %d %d %d %d, want 5, 193, -1, 201", a.bit, b.bit, c.bit, d.bit)
+	}
+	clock := &gameClock{}
+	for _, c := range []struct {
+		pt   *pendingTree
+		want float64
+	}{
+		{a, 240},
+		{b, 330 - 2.0/ticksPerSecond},
+		{c, model.TreeRegrowSec},
+		{d, 60},
+	} {
+		if got := c.pt.record(1, clock).DurationSec; got != c.want {
+			t.Errorf("tree cut at tick %d: duration %v, want %v", c.pt.startTick, got, c.want)
+		}
+	}
+}
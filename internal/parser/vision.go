@@ -0,0 +1,385 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cndotaplan/cndotaplan/internal/coord"
+	"github.com/cndotaplan/cndotaplan/internal/model"
+	"github.com/cndotaplan/cndotaplan/internal/region"
+	"github.com/dotabuff/manta"
+	"github.com/dotabuff/manta/dota"
+)
+
+const (
+	itemSmoke       = "item_smoke_of_deceit"
+	itemDust        = "item_dust"
+	modifierSmoke   = "modifier_smoke_of_deceit"
+	abilityTwinGate = "twin_gate_portal_warp"
+	gemClassName    = "CDOTA_Item_GemOfTrueSight"
+	// abilityDarkAscension 暗夜猎手大招；game rules 没有临时夜晚字段的旧录像按施放时刻加固定时长记录
+	abilityDarkAscension = "night_stalker_darkness"
+	darkAscensionSec     = 30
+	heroNightStalker     = "npc_dota_hero_night_stalker"
+	// smokeGroupTicks 使用雾后这么多 tick 内进雾的友方英雄算作同一次雾
+	smokeGroupTicks = 15
+	// gemSampleTicks 每秒检查一次各英雄物品栏中的宝石
+	gemSampleTicks = ticksPerSecond
+	// inventorySlots 物品栏（不含背包与中立物品栏），背包里的宝石不生效
+	inventorySlots = 6
+)
+
+// pendingVision 解析中的视野事件，结束时（或录像结束）生成 model.VisionEvent
+type pendingVision struct {
+	Kind       string
+	TeamID     int32
+	Owner      wardOwner
+	PosX, PosY float64 // 世界坐标
+	StartTick  uint32
+	ServerTime float64
+	EndTick    uint32
+	FixedSec   float64 // 瞬时事件的游戏内固定时长（扫描），非 0 时不按 tick 差计算
+	AliveAtEnd bool
+	Heroes     int
+}
+
+// visionTracker 从战斗日志、观战者单位指令与实体收集眼位以外的视野事件：
+// 雾/粉/双生门来自战斗日志的物品与技能使用，扫描来自 DOTA_UNIT_ORDER_RADAR 指令（带扫描中心坐标），
+// 宝石按秒检查英雄物品栏得出持有区间，哨塔按实体队伍变化得出占领区间。
+type visionTracker struct {
+	events   []*pendingVision
+	smokes   map[string]*pendingVision // 使用者英雄名 → 雾尚未消失
+	gems     map[int32]*pendingVision  // 宝石实体 index → 当前持有
+	watchers map[int32]*pendingVision  // 哨塔实体 index → 当前占领
+	lastScan map[int32]uint32          // 队伍 → 上次扫描 tick，用于去掉重复下发的指令
+	lastGem  uint32
+	// night 当前的临时夜晚；nightRules 为 game rules 上有临时夜晚字段，此时不再从战斗日志推断
+	night      *pendingVision
+	nightRules bool
+}
+
+func newVisionTracker() *visionTracker {
+	return &visionTracker{
+		smokes:   map[string]*pendingVision{},
+		gems:     map[int32]*pendingVision{},
+		watchers: map[int32]*pendingVision{},
+		lastScan: map[int32]uint32{},
+	}
+}
+
+// start 以英雄（可为 nil）为使用者开始一个事件
+func (t *visionTracker) start(p *session, clock *gameClock, kind string, hero *manta.Entity, playerID int32) *pendingVision {
+	pv := &pendingVision{
+		Kind:       kind,
+		Owner:      wardOwner{PlayerID: -1},
+		StartTick:  p.NetTick,
+		ServerTime: clock.serverTime(p.NetTick),
+		EndTick:    p.NetTick,
+	}
+	if hero != nil {
+		pv.TeamID = readTeamNum(hero)
+		pv.PosX, pv.PosY = getWardPosition(hero)
+		if playerID >= 0 {
+			pv.Owner = playerOwner(p, playerID)
+		}
+	}
+	t.events = append(t.events, pv)
+	return pv
+}
+
+// onEntry 处理一条战斗日志
+func (t *visionTracker) onEntry(p *session, clock *gameClock, m *dota.CMsgDOTACombatLogEntry) {
+	name := func(i uint32) string {
+		s, _ := p.LookupStringByIndex("CombatLogNames", int32(i))
+		return s
+	}
+	switch m.GetType() {
+	case dota.DOTA_COMBATLOG_TYPES_DOTA_COMBATLOG_ITEM:
+		if m.GetIsAttackerIllusion() {
+			return
+		}
+		user := name(m.GetAttackerName())
+		switch name(m.GetInflictorName()) {
+		case itemSmoke:
+			hero, pid := heroByName(p, user)
+			t.smokes[user] = t.start(p, clock, model.VisionSmoke, hero, pid)
+		case itemDust:
+			hero, pid := heroByName(p, user)
+			t.start(p, clock, model.VisionDust, hero, pid)
+		}
+	case dota.DOTA_COMBATLOG_TYPES_DOTA_COMBATLOG_ABILITY:
+		if m.GetIsAttackerIllusion() {
+			return
+		}
+		switch name(m.GetInflictorName()) {
+		case abilityTwinGate:
+			hero, pid := heroByName(p, name(m.GetAttackerName()))
+			t.start(p, clock, model.VisionTwinGate, hero, pid)
+		case abilityDarkAscension:
+			if t.nightRules {
+				return
+			}
+			hero, pid := heroByName(p, name(m.GetAttackerName()))
+			t.start(p, clock, model.VisionNight, hero, pid).FixedSec = darkAscensionSec
+		}
+	case dota.DOTA_COMBATLOG_TYPES_DOTA_COMBATLOG_MODIFIER_ADD:
+		if name(m.GetInflictorName()) != modifierSmoke || !m.GetIsTargetHero() || m.GetIsTargetIllusion() {
+			return
+		}
+		team := int32(m.GetTargetTeam())
+		for _, pv := range t.smokes {
+			if pv.TeamID == team && p.NetTick-pv.StartTick <= smokeGroupTicks {
+				pv.Heroes++
+				return
+			}
+		}
+	case dota.DOTA_COMBATLOG_TYPES_DOTA_COMBATLOG_MODIFIER_REMOVE:
+		if name(m.GetInflictorName()) != modifierSmoke {
+			return
+		}
+		target := name(m.GetTargetName())
+		if pv, ok := t.smokes[target]; ok {
+			pv.EndTick = p.NetTick
+			delete(t.smokes, target)
+		}
+	}
+}
+
+// onOrder 观战者可见的单位指令；扫描指令带扫描中心的世界坐标
+func (t *visionTracker) onOrder(p *session, clock *gameClock, m *dota.CDOTAUserMsg_SpectatorPlayerUnitOrders) {
+	if m.GetOrderType() != int32(dota.DotaunitorderT_DOTA_UNIT_ORDER_RADAR) || m.GetPosition() == nil {
+		return
+	}
+	var hero *manta.Entity
+	if units := m.GetUnits(); len(units) > 0 {
+		hero = p.FindEntity(units[0])
+	}
+	pid := int32(-1)
+	if hero != nil {
+		if v, ok := hero.GetInt32("m_iPlayerID"); ok {
+			pid = normalizePlayerID(v)
+		}
+	}
+	team := int32(0)
+	if hero != nil {
+		team = readTeamNum(hero)
+	}
+	// 找不到施放者时无法按队伍去重，也不知道是哪一方的扫描，丢弃
+	if team == 0 {
+		return
+	}
+	// 冷却中重复点击也会下发指令：扫描持续期间同一队伍的后续指令视为无效
+	if last, ok := t.lastScan[team]; ok && p.NetTick-last < model.ScanDurationSec*ticksPerSecond {
+		return
+	}
+	t.lastScan[team] = p.NetTick
+	pv := t.start(p, clock, model.VisionScan, hero, pid)
+	pv.PosX, pv.PosY = float64(m.GetPosition().GetX()), float64(m.GetPosition().GetY())
+	pv.FixedSec = model.ScanDurationSec
+}
+
+// onEntity 跟踪哨塔的占领方与 game rules 上的临时夜晚
+func (t *visionTracker) onEntity(p *session, clock *gameClock, e *manta.Entity, op manta.EntityOp) {
+	if e.GetClassName() == "CDOTAGamerulesProxy" {
+		t.updateNight(p, clock, e)
+		return
+	}
+	// 哨塔（npc_dota_lantern）实体类名含 Lantern，未占领时队伍为中立
+	if !strings.Contains(e.GetClassName(), "Lantern") {
+		return
+	}
+	idx := e.GetIndex()
+	cur := t.watchers[idx]
+	if op.Flag(manta.EntityOpDeleted) {
+		if cur != nil {
+			cur.EndTick = p.NetTick
+			delete(t.watchers, idx)
+		}
+		return
+	}
+	team := readTeamNum(e)
+	if team != teamRadiant && team != teamDire {
+		team = 0
+	}
+	if cur != nil && cur.TeamID == team {
+		return
+	}
+	if cur != nil {
+		cur.EndTick = p.NetTick
+		delete(t.watchers, idx)
+	}
+	if team == 0 {
+		return
+	}
+	// 占领者：该队离哨塔最近的英雄
+	x, y := getWardPosition(e)
+	hero, pid := nearestHero(p, team, x, y)
+	pv := t.start(p, clock, model.VisionWatcher, hero, pid)
+	pv.TeamID = team
+	pv.PosX, pv.PosY = x, y
+	t.watchers[idx] = pv
+}
+
+// updateNight m_bIsTemporaryNight（月蚀等）或 m_bIsNightstalkerNight（黑暗飞升）为真期间记为一次临时夜晚
+func (t *visionTracker) updateNight(p *session, clock *gameClock, e *manta.Entity) {
+	temporary, ok1 := e.GetBool("m_pGameRules.m_bIsTemporaryNight")
+	stalker, ok2 := e.GetBool("m_pGameRules.m_bIsNightstalkerNight")
+	if !ok1 && !ok2 {
+		return
+	}
+	t.nightRules = true
+	switch active := temporary || stalker; {
+	case active && t.night == nil:
+		var hero *manta.Entity
+		pid := int32(-1)
+		if stalker {
+			hero, pid = heroByName(p, heroNightStalker)
+		}
+		t.night = t.start(p, clock, model.VisionNight, hero, pid)
+		if stalker {
+			t.night.Owner.HeroName = heroNightStalker // 找不到英雄实体时仍标明是黑暗飞升
+		}
+	case !active && t.night != nil:
+		t.night.EndTick = p.NetTick
+		t.night = nil
+	}
+}
+
+// sample 每秒检查宝石持有者
+func (t *visionTracker) sample(p *session, clock *gameClock) {
+	if p.NetTick < t.lastGem+gemSampleTicks {
+		return
+	}
+	t.lastGem = p.NetTick
+	carriers := map[int32]int32{} // 宝石 index → 玩家 ID
+	heroes := map[int32]*manta.Entity{}
+	for pid := int32(0); pid < 10; pid++ {
+		hero := selectedHero(p, pid)
+		if hero == nil {
+			continue
+		}
+		heroes[pid] = hero
+		for slot := 0; slot < inventorySlots; slot++ {
+			if item := heroItem(p, hero, slot); item != nil && item.GetClassName() == gemClassName {
+				carriers[item.GetIndex()] = pid
+			}
+		}
+	}
+	for idx, pv := range t.gems {
+		if pid, ok := carriers[idx]; !ok || pid != pv.Owner.PlayerID {
+			pv.EndTick = p.NetTick
+			delete(t.gems, idx)
+		}
+	}
+	for idx, pid := range carriers {
+		if _, ok := t.gems[idx]; !ok {
+			t.gems[idx] = t.start(p, clock, model.VisionGem, heroes[pid], pid)
+		}
+	}
+}
+
+// finish 录像结束：仍在持续的雾、宝石、哨塔截至最后一个 tick
+func (t *visionTracker) finish(endTick uint32) {
+	for _, open := range []map[int32]*pendingVision{t.gems, t.watchers} {
+		for _, pv := range open {
+			pv.EndTick, pv.AliveAtEnd = endTick, true
+		}
+	}
+	for _, pv := range t.smokes {
+		pv.EndTick, pv.AliveAtEnd = endTick, true
+	}
+	if t.night != nil {
+		t.night.EndTick, t.night.AliveAtEnd = endTick, true
+	}
+	sort.SliceStable(t.events, func(i, j int) bool { return t.events[i].StartTick < t.events[j].StartTick })
+}
+
+func (pv *pendingVision) record(matchID int64, clock *gameClock, regions *region.Map) model.VisionEvent {
+	ev := model.VisionEvent{
+		MatchID:     matchID,
+		Kind:        pv.Kind,
+		TeamID:      pv.TeamID,
+		PlayerSlot:  pv.Owner.playerSlot(),
+		AccountID:   pv.Owner.AccountID,
+		PlayerName:  pv.Owner.PlayerName,
+		HeroName:    pv.Owner.HeroName,
+		PosX:        pv.PosX,
+		PosY:        pv.PosY,
+		CoordSpace:  string(coord.World),
+		GameTimeSec: clock.gameTimeSec(pv.ServerTime),
+		DurationSec: tickSpanSec(pv.StartTick, pv.EndTick),
+		AliveAtEnd:  pv.AliveAtEnd,
+		Heroes:      pv.Heroes,
+	}
+	if pv.FixedSec > 0 {
+		ev.DurationSec = pv.FixedSec
+	}
+	ev.RegionTag = regions.TagIn(ev.PosX, ev.PosY, coord.World)
+	return ev
+}
+
+// selectedHero 玩家（0-9）当前操控的英雄实体
+func selectedHero(p *session, playerID int32) *manta.Entity {
+	pr := findPlayerResource(p)
+	if pr == nil {
+		return nil
+	}
+	h := readHandleField(pr, fmt.Sprintf("m_vecPlayerTeamData.%04d.m_hSelectedHero", playerID))
+	if h == 0 {
+		return nil
+	}
+	if hero := p.FindEntityByHandle(h); hero != nil && isHeroEntity(hero) {
+		return hero
+	}
+	return nil
+}
+
+// heroByName 按战斗日志单位名（npc_dota_hero_xxx）找英雄本体及其玩家 ID：单位名与各玩家
+// m_nSelectedHeroID 对应的 npc 名（见 playerHeroName）比较。找不到返回 nil, -1
+func heroByName(p *session, name string) (*manta.Entity, int32) {
+	if !strings.HasPrefix(name, "npc_dota_hero_") {
+		return nil, -1
+	}
+	pr := findPlayerResource(p)
+	if pr == nil {
+		return nil, -1
+	}
+	for pid := int32(0); pid < 10; pid++ {
+		id, _ := pr.GetInt32(fmt.Sprintf("m_vecPlayerTeamData.%04d.m_nSelectedHeroID", pid))
+		if playerHeroName(p, pid, id) != name {
+			continue
+		}
+		if hero := selectedHero(p, pid); hero != nil {
+			return hero, pid
+		}
+	}
+	return nil, -1
+}
+
+// nearestHero team 一方离世界坐标 (x, y) 最近的英雄
+func nearestHero(p *session, team int32, x, y float64) (*manta.Entity, int32) {
+	var best *manta.Entity
+	bestPID, bestD := int32(-1), 0.0
+	for pid := int32(0); pid < 10; pid++ {
+		hero := selectedHero(p, pid)
+		if hero == nil || readTeamNum(hero) != team {
+			continue
+		}
+		hx, hy := getWardPosition(hero)
+		if d := (hx-x)*(hx-x) + (hy-y)*(hy-y); best == nil || d < bestD {
+			best, bestPID, bestD = hero, pid, d
+		}
+	}
+	return best, bestPID
+}
+
+// heroItem 英雄物品栏第 slot 格的物品实体
+func heroItem(p *session, hero *manta.Entity, slot int) *manta.Entity {
+	for _, field := range []string{"m_hItems.%04d", "m_Inventory.m_hItems.%04d"} {
+		if h := readHandleField(hero, fmt.Sprintf(field, slot)); h != 0 {
+			return p.FindEntityByHandle(h)
+		}
+	}
+	return nil
+}
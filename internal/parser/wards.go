@@ -1,138 +1,145 @@
 package parser
 
 import (
-	"compress/bzip2"
+	"context"
 	"fmt"
 	"io"
 	"os"
-	"strings"
 
+	"github.com/cndotaplan/cndotaplan/internal/coord"
 	"github.com/cndotaplan/cndotaplan/internal/model"
 	"github.com/dotabuff/manta"
 )
 
 const ticksPerSecond = 30
 
-// ExtractWards 从 .dem 或 .dem.bz2 中解析所有眼位，返回眼位记录列表。
+// ExtractWards 从录像文件（.dem、.dem.bz2 或 gzip/zstd 压缩，按内容识别；"-" 为 stdin）中解析所有眼位，
+// 返回眼位记录列表；流式解析见 WardExtractor。
 // 眼的持续时间必须由「实体创建」到「实体销毁」的 tick 差计算，不能依赖录像内其它字段（如 m_flCreateTime）。
-// matchID 用于填充 WardRecord.MatchID，若未知可传 0。
+// GameTimeSec 以号角为 0 点（开局前为负），由 game rules 的时间字段换算，见 gameClock。
+// matchID 用于填充 WardRecord.MatchID，传 0 时取录像中的 match_id；比赛元数据与其它视野事件见 ExtractReplay。
+// 录像截断或损坏时同时返回已解析的记录与 *PartialError（见 WardExtractor.Run）。
 func ExtractWards(demPath string, matchID int64) ([]model.WardRecord, error) {
-	f, err := os.Open(demPath)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-
-	var r io.Reader = f
-	// 若为 .bz2，自动解压
-	if strings.HasSuffix(strings.ToLower(demPath), ".bz2") {
-		r = bzip2.NewReader(f)
+	f := os.Stdin
+	if demPath != "-" {
+		var err error
+		if f, err = os.Open(demPath); err != nil {
+			return nil, err
+		}
+		defer f.Close()
 	}
+	return ExtractWardsFrom(f, matchID)
+}
 
-	parser, err := manta.NewStreamParser(r)
-	if err != nil {
-		return nil, fmt.Errorf("NewStreamParser: %w", err)
-	}
+// Replay 一场录像的解析结果
+type Replay struct {
+	Info   model.MatchInfo
+	Wards  []model.WardRecord
+	Vision []model.VisionEvent // 眼位以外的视野事件
+	Tracks []model.HeroTrack   // 英雄位置采样，见 WardExtractor.HeroSampleSec
+	Trees  []model.TreeEvent   // 砍树与临时树
+}
 
-	// active：创建时登记，销毁时取出并统计持续时间，保证每条眼的 duration = 销毁 tick - 创建 tick
-	active := make(map[int32]*pendingWard)
-	var result []model.WardRecord
+// ExtractReplay 与 ExtractWards 相同，同时返回录像中的比赛元数据（match_id、版本、联赛、战队、BP、胜方、时长）
+// 与其它视野事件。返回 *PartialError 时 Replay 仍非 nil，含截断前的部分结果。
+func ExtractReplay(demPath string, matchID int64) (*Replay, error) {
+	return NewWardExtractor(matchID).RunFile(context.Background(), demPath)
+}
 
-	parser.OnEntity(func(e *manta.Entity, op manta.EntityOp) error {
-		className := e.GetClassName()
-		if className != "CDOTA_NPC_Observer_Ward" && className != "CDOTA_NPC_Sentry_Ward" {
-			return nil
+// RunFile 解析录像文件（"-" 为 stdin），返回全部结果；见 ExtractReplay
+func (x *WardExtractor) RunFile(ctx context.Context, demPath string) (*Replay, error) {
+	f := os.Stdin
+	if demPath != "-" {
+		var err error
+		if f, err = os.Open(demPath); err != nil {
+			return nil, err
 		}
+		defer f.Close()
+	}
+	records, err := x.Run(ctx, f)
+	if records == nil && err != nil {
+		return nil, err
+	}
+	return &Replay{Info: x.Info, Wards: records, Vision: x.Vision, Tracks: x.Tracks, Trees: x.Trees}, err
+}
 
-		wardType := "observer"
-		if className == "CDOTA_NPC_Sentry_Ward" {
-			wardType = "sentry"
-		}
+// ExtractWardsFrom 与 ExtractWards 相同，但从任意 reader 读取（HTTP 响应体、tar 条目等），压缩格式按魔数识别
+func ExtractWardsFrom(r io.Reader, matchID int64) ([]model.WardRecord, error) {
+	return NewWardExtractor(matchID).Run(context.Background(), r)
+}
 
-		if op.Flag(manta.EntityOpCreated) || (op.Flag(manta.EntityOpEntered) && op.Flag(manta.EntityOpCreated)) {
-			x, y := getWardPosition(e)
-			team := getWardTeam(parser, e)
-			tick := parser.NetTick // 记录创建时刻 tick，仅在与销毁 tick 做差时用于计算持续时间
-			active[e.GetIndex()] = &pendingWard{
-				TeamID:    team,
-				WardType:  wardType,
-				PosX:      x,
-				PosY:      y,
-				StartTick: tick,
-			}
-			return nil
-		}
+// pendingWard 未销毁的眼，在实体删除或录像结束时根据 StartTick 与当前 tick 差计算持续时间后写入结果。
+type pendingWard struct {
+	Index      int32 // 实体 index，仅用于流式事件中区分同一只眼
+	TeamID     int32
+	WardType   string
+	PosX       float64
+	PosY       float64
+	StartTick  uint32  // 实体创建时的 NetTick，仅用于与删除时 tick 做差得到持续时间
+	Roshan     string  // 插眼时肉山状态（model.RoshanUp / RoshanDown），未知为空
+	ServerTime float64 // 实体创建时的服务器时间，解析结束后换算为 GameTimeSec
+	EndTick    uint32  // 实体删除时的 NetTick；录像结束仍存活时为最后一个 tick
+	AliveAtEnd bool
+	Owner      wardOwner
+	Cause      string     // model.Removal*，由 combatLog.attribute 填写
+	Death      *wardDeath // 配对到的战斗日志死亡事件，可能为 nil
+}
 
-		if op.Flag(manta.EntityOpUpdated) {
-			if pw, ok := active[e.GetIndex()]; ok {
-				if x, y := getWardPosition(e); x != 0 || y != 0 {
-					pw.PosX, pw.PosY = x, y
-				}
-				if t := getWardTeam(parser, e); t != 0 {
-					pw.TeamID = t
-				}
-			}
-			return nil
-		}
+// durationSec 持续时间仅由 创建→结束 的 tick 差得出，不依赖实体内任何时间字段；
+// AliveAtEnd 时截至最后一个 tick，是右删失的下界。
+func (pw *pendingWard) durationSec() float64 {
+	return tickSpanSec(pw.StartTick, pw.EndTick)
+}
 
-		if op.Flag(manta.EntityOpDeleted) {
-			idx := e.GetIndex()
-			pw, ok := active[idx]
-			if !ok {
-				return nil
-			}
-			delete(active, idx)
-			teamID := pw.TeamID
-			if t := getWardTeam(parser, e); t != 0 {
-				teamID = t
-			}
-			// 持续时间仅由 创建→销毁 的 tick 差得出，不依赖实体内任何时间字段
-			endTick := parser.NetTick
-			durationTicks := endTick - pw.StartTick
-			if durationTicks < 0 {
-				durationTicks = 0
-			}
-			durationSec := float64(durationTicks) / ticksPerSecond
-			maxSec := float64(model.ObserverWardMaxDurationSec)
-			if pw.WardType == "sentry" {
-				maxSec = float64(model.SentryWardMaxDurationSec)
-			}
-			isDenied := durationSec < maxSec-5 // 提前 5 秒以上视为疑似被反
-			gameTimeSec := float64(pw.StartTick) / ticksPerSecond
-			// 删除时再读一次坐标（创建时 CBodyComponent 可能尚未同步）
-			posX, posY := getWardPosition(e)
-			if posX == 0 && posY == 0 {
-				posX, posY = pw.PosX, pw.PosY
-			}
-			result = append(result, model.WardRecord{
-				MatchID:     matchID,
-				TeamID:      teamID,
-				WardType:    pw.WardType,
-				PosX:        posX,
-				PosY:        posY,
-				GameTimeSec: gameTimeSec,
-				DurationSec: durationSec,
-				IsDenied:    isDenied,
-				RegionTag:   "", // 由后续 region 包根据坐标打标
-			})
-			return nil
-		}
-		return nil
-	})
+func tickSpanSec(start, end uint32) float64 {
+	if end <= start {
+		return 0
+	}
+	return float64(end-start) / ticksPerSecond
+}
 
-	if err := parser.Start(); err != nil && err != io.EOF {
-		return nil, fmt.Errorf("parser.Start: %w", err)
+func (pw *pendingWard) maxDurationSec() float64 {
+	if pw.WardType == "sentry" {
+		return model.SentryWardMaxDurationSec
 	}
-	return result, nil
+	return model.ObserverWardMaxDurationSec
 }
 
-// pendingWard 未销毁的眼，仅在实体删除时根据 StartTick 与当前 tick 差计算持续时间后写入结果。
-type pendingWard struct {
-	TeamID    int32
-	WardType  string
-	PosX      float64
-	PosY      float64
-	StartTick uint32 // 实体创建时的 NetTick，仅用于与删除时 tick 做差得到持续时间
+// record 生成最终的 WardRecord
+func (pw *pendingWard) record(matchID int64, clock *gameClock) model.WardRecord {
+	rec := model.WardRecord{
+		MatchID:      matchID,
+		TeamID:       pw.TeamID,
+		WardType:     pw.WardType,
+		PosX:         pw.PosX,
+		PosY:         pw.PosY,
+		CoordSpace:   string(coord.World),
+		GameTimeSec:  clock.gameTimeSec(pw.ServerTime),
+		DurationSec:  pw.durationSec(),
+		PlayerSlot:   pw.Owner.playerSlot(),
+		AccountID:    pw.Owner.AccountID,
+		PlayerName:   pw.Owner.PlayerName,
+		HeroID:       pw.Owner.HeroID,
+		HeroName:     pw.Owner.HeroName,
+		AliveAtEnd:   pw.AliveAtEnd,
+		RemovalCause: pw.Cause,
+		RoshanState:  pw.Roshan,
+	}
+	switch pw.Cause {
+	case model.RemovalDewarded, model.RemovalDenied:
+		rec.IsDenied = true
+	case model.RemovalUnknown:
+		// 没有战斗日志可对照时退回旧的推断：提前 5 秒以上消失视为疑似被反
+		rec.IsDenied = rec.DurationSec < rec.MaxDurationSec()-5
+	}
+	if d := pw.Death; d != nil {
+		rec.KillerUnit = d.AttackerName
+		rec.KillerTeam = d.AttackerTeam
+		rec.KillerIsHero = d.AttackerHero
+		rec.BountyGold = d.Gold
+		rec.BountyXP = d.XP
+	}
+	return rec
 }
 
 // cellSize Source 2 世界坐标：世界位置 = cell * cellSize + vec
@@ -145,7 +152,7 @@ const (
 )
 
 // getWardTeam 从眼位实体解析队伍：优先 m_iTeamNum，再通过 m_hOwnerEntity 查插眼英雄的队伍。
-func getWardTeam(p *manta.Parser, e *manta.Entity) int32 {
+func getWardTeam(p *session, e *manta.Entity) int32 {
 	// 1. 眼位自身的 m_iTeamNum
 	if t := readTeamNum(e); t != 0 {
 		return t
@@ -196,12 +203,8 @@ func getWardTeam(p *manta.Parser, e *manta.Entity) int32 {
 	if pid, ok := e.GetInt32("m_nPlayerOwnerID"); ok {
 		pr := findPlayerResource(p)
 		if pr != nil {
-			// 玩家 0-4 天辉，5-9 夜魇；m_nPlayerOwnerID 可能为 16 等，尝试 16&0xF=0 或 16>>1=8
-			slot := int(pid)
-			if slot > 9 {
-				slot = slot & 0xF
-			}
-			if slot >= 0 && slot <= 9 {
+			// 玩家 0-4 天辉，5-9 夜魇；m_nPlayerOwnerID 可能为 16 等，见 normalizePlayerID
+			if slot := normalizePlayerID(pid); slot >= 0 {
 				field := fmt.Sprintf("m_vecPlayerTeamData.%04d.m_iTeamNum", slot)
 				if t, ok := pr.GetInt32(field); ok && (t == teamRadiant || t == teamDire) {
 					return t
@@ -218,15 +221,32 @@ func getWardTeam(p *manta.Parser, e *manta.Entity) int32 {
 	return 0
 }
 
-// findPlayerResource 查找 CDOTA_PlayerResource 实体
-func findPlayerResource(p *manta.Parser) *manta.Entity {
-	list := p.FilterEntity(func(et *manta.Entity) bool {
-		return et != nil && et.GetClassName() == "CDOTA_PlayerResource"
-	})
-	if len(list) > 0 {
-		return list[0]
+// playerResourceClass 玩家名字、Steam ID、队伍与所选英雄所在的实体，整场只有一个
+const playerResourceClass = "CDOTA_PlayerResource"
+
+// session 一次解析：解析器与解析中记下的 CDOTA_PlayerResource 实体，之后查玩家信息不再遍历全部实体。
+// WardExtractor.Run 每次新建，传给各跟踪器
+type session struct {
+	*manta.Parser
+	playerResource *manta.Entity // 创建前为 nil
+}
+
+// onEntity 实体回调中记下 CDOTA_PlayerResource 的创建与删除
+func (s *session) onEntity(e *manta.Entity, op manta.EntityOp) {
+	if e.GetClassName() != playerResourceClass {
+		return
+	}
+	switch {
+	case op.Flag(manta.EntityOpDeleted):
+		s.playerResource = nil
+	case op.Flag(manta.EntityOpCreated):
+		s.playerResource = e
 	}
-	return nil
+}
+
+// findPlayerResource CDOTA_PlayerResource 实体，创建前为 nil
+func findPlayerResource(p *session) *manta.Entity {
+	return p.playerResource
 }
 
 func readTeamNum(e *manta.Entity) int32 {
@@ -0,0 +1,138 @@
+// Package predict 对手眼位预测：按某队历史眼位在常用眼位（internal/spot）上的经验频率，
+// 估计其在给定阵营、时间窗与肉山状态下下一只眼插在各眼位的概率。
+//
+// 类别为目录中的眼位加「其他」（不在任何眼位内的眼）。先在该阵营全部眼上做加性平滑得到先验
+// p_side(c) = (n_side(c) + Alpha) / (N_side + Alpha·(K+1))，再用时间窗与肉山状态下的计数按
+// 权重 PriorWeight 向先验收缩：p(c) = (n(c) + m·p_side(c)) / (N + m)。样本少时结果接近该阵营的
+// 整体习惯，样本多时接近该条件下的实际频率。
+package predict
+
+import (
+	"math"
+	"sort"
+
+	"github.com/cndotaplan/cndotaplan/internal/model"
+	"github.com/cndotaplan/cndotaplan/internal/spot"
+)
+
+// Query 预测条件，零值为不限
+type Query struct {
+	Side     int32   // 该队的阵营：2=天辉 3=夜魇
+	FromMin  float64 // 插眼时间窗 [FromMin, ToMin)（分钟）；ToMin 为 0 表示不限
+	ToMin    float64
+	Roshan   string // model.RoshanUp / RoshanDown
+	WardType string // observer / sentry
+}
+
+// Options 平滑参数
+type Options struct {
+	Alpha       float64 // 加性平滑的伪计数
+	PriorWeight float64 // 条件计数向阵营先验收缩的权重（相当于多少只眼）
+}
+
+// DefaultOptions 每类半只眼的伪计数，先验相当于 10 只眼
+var DefaultOptions = Options{Alpha: 0.5, PriorWeight: 10}
+
+// OtherID 不在任何眼位内的眼的类别
+const OtherID = "other"
+
+// Prediction 一个眼位的预测概率，坐标与半径为世界单位
+type Prediction struct {
+	SpotID      string  `json:"spot_id"`
+	Label       string  `json:"label,omitempty"`
+	Region      string  `json:"region,omitempty"`
+	X           float64 `json:"x"`
+	Y           float64 `json:"y"`
+	Radius      float64 `json:"radius"`
+	Probability float64 `json:"probability"`
+	Count       int     `json:"count"`      // 条件内该眼位的眼数
+	SideCount   int     `json:"side_count"` // 该阵营全部眼中该眼位的眼数
+}
+
+// Result 预测结果
+type Result struct {
+	Spots []Prediction `json:"spots"` // 按概率降序，截取前 n 个
+	// Other 落在目录眼位之外的概率
+	Other float64 `json:"other"`
+	// Wards 条件内的眼数，SideWards 该阵营（及眼类型）全部眼数；Wards 很少时结果主要来自先验
+	Wards     int `json:"wards"`
+	SideWards int `json:"side_wards"`
+	// Unknown 因肉山状态未知（OpenDota 数据或旧库）而未计入条件的眼数
+	Unknown int `json:"unknown,omitempty"`
+}
+
+// Predict 按 records（该队的眼位，SpotID 已按 catalog 归类）估计 q 条件下各眼位的概率，返回前 n 个（n <= 0 为全部）。
+// 指定 Roshan 时，肉山状态未知的眼只计入先验。
+func Predict(records []model.WardRecord, catalog *spot.Catalog, q Query, opts Options, n int) Result {
+	if opts.Alpha <= 0 {
+		opts.Alpha = DefaultOptions.Alpha
+	}
+	if opts.PriorWeight < 0 {
+		opts.PriorWeight = 0
+	}
+	to := q.ToMin
+	if to <= 0 {
+		to = math.Inf(1)
+	}
+	known := map[string]bool{}
+	for _, s := range catalog.Spots {
+		known[s.ID] = true
+	}
+	category := func(w *model.WardRecord) string {
+		if known[w.SpotID] {
+			return w.SpotID
+		}
+		return OtherID
+	}
+
+	var res Result
+	side, cond := map[string]int{}, map[string]int{}
+	for i := range records {
+		w := &records[i]
+		if (q.Side != 0 && w.TeamID != q.Side) || (q.WardType != "" && w.WardType != q.WardType) {
+			continue
+		}
+		c := category(w)
+		side[c]++
+		res.SideWards++
+		if m := w.GameTimeSec / 60; m < q.FromMin || m >= to {
+			continue
+		}
+		if q.Roshan != "" && w.RoshanState != q.Roshan {
+			if w.RoshanState == "" {
+				res.Unknown++
+			}
+			continue
+		}
+		cond[c]++
+		res.Wards++
+	}
+
+	if res.Wards == 0 && opts.PriorWeight == 0 {
+		// 没有条件内样本也没有先验权重时退回先验
+		opts.PriorWeight = 1
+	}
+	k := float64(len(catalog.Spots) + 1)
+	prob := func(c string) float64 {
+		prior := (float64(side[c]) + opts.Alpha) / (float64(res.SideWards) + opts.Alpha*k)
+		return (float64(cond[c]) + opts.PriorWeight*prior) / (float64(res.Wards) + opts.PriorWeight)
+	}
+	for _, s := range catalog.Spots {
+		res.Spots = append(res.Spots, Prediction{
+			SpotID: s.ID, Label: s.Label, Region: s.Region, X: s.X, Y: s.Y, Radius: s.Radius,
+			Probability: prob(s.ID), Count: cond[s.ID], SideCount: side[s.ID],
+		})
+	}
+	res.Other = prob(OtherID)
+	sort.SliceStable(res.Spots, func(i, j int) bool {
+		a, b := res.Spots[i], res.Spots[j]
+		if a.Probability != b.Probability {
+			return a.Probability > b.Probability
+		}
+		return a.SpotID < b.SpotID
+	})
+	if n > 0 && len(res.Spots) > n {
+		res.Spots = res.Spots[:n]
+	}
+	return res
+}
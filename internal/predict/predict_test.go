@@ -0,0 +1,80 @@
+package predict
+
+import (
+	"math"
+	"testing"
+
+	"github.com/cndotaplan/cndotaplan/internal/model"
+	"github.com/cndotaplan/cndotaplan/internal/spot"
+)
+
+// fixture 天辉方 10 只眼：眼位 a 6 只（5 分钟、肉山存活），b 2 只（20 分钟、肉山死亡），
+// 目录外 2 只（5 分钟、肉山状态未知）；另有夜魇方 1 只在 b
+func fixture() ([]model.WardRecord, *spot.Catalog) {
+	catalog := &spot.Catalog{Spots: []spot.Spot{{ID: "a", X: 1000, Y: 1000, Radius: 100}, {ID: "b", X: 2000, Y: 2000, Radius: 100}}}
+	ward := func(team int32, spotID string, min float64, roshan string) model.WardRecord {
+		return model.WardRecord{TeamID: team, WardType: "observer", SpotID: spotID, GameTimeSec: min * 60, RoshanState: roshan}
+	}
+	var recs []model.WardRecord
+	for i := 0; i < 6; i++ {
+		recs = append(recs, ward(2, "a", 5, model.RoshanUp))
+	}
+	recs = append(recs, ward(2, "b", 20, model.RoshanDown), ward(2, "b", 20, model.RoshanDown))
+	recs = append(recs, ward(2, "", 5, ""), ward(2, "gone", 5, ""))
+	recs = append(recs, ward(3, "b", 5, model.RoshanUp))
+	return recs, catalog
+}
+
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+func TestPredictSmoothing(t *testing.T) {
+	recs, catalog := fixture()
+	res := Predict(recs, catalog, Query{Side: 2, ToMin: 10, Roshan: model.RoshanUp}, DefaultOptions, 0)
+	if res.Wards != 6 || res.SideWards != 10 || res.Unknown != 2 {
+		t.Fatalf("wards %d side %d unknown %d, want 6, 10, 2", res.Wards, res.SideWards, res.Unknown)
+	}
+	// 先验 (n_side + 0.5) / (10 + 0.5·3)，再以 10 只眼的权重收缩
+	prior := map[string]float64{"a": 6.5 / 11.5, "b": 2.5 / 11.5, OtherID: 2.5 / 11.5}
+	want := map[string]float64{
+		"a":     (6 + 10*prior["a"]) / 16,
+		"b":     10 * prior["b"] / 16,
+		OtherID: 10 * prior[OtherID] / 16,
+	}
+	if len(res.Spots) != 2 || res.Spots[0].SpotID != "a" || res.Spots[1].SpotID != "b" {
+		t.Fatalf("spots %+v, want a then b", res.Spots)
+	}
+	sum := res.Other
+	for _, p := range res.Spots {
+		if !near(p.Probability, want[p.SpotID]) {
+			t.Errorf("p(%s) = %v, want %v", p.SpotID, p.Probability, want[p.SpotID])
+		}
+		sum += p.Probability
+	}
+	if !near(res.Other, want[OtherID]) || !near(sum, 1) {
+		t.Errorf("other %v, total %v; want %v and 1", res.Other, sum, want[OtherID])
+	}
+	if res.Spots[0].Count != 6 || res.Spots[1].Count != 0 || res.Spots[1].SideCount != 2 {
+		t.Errorf("counts %+v", res.Spots)
+	}
+
+	if top := Predict(recs, catalog, Query{Side: 2}, DefaultOptions, 1); len(top.Spots) != 1 || top.Spots[0].SpotID != "a" {
+		t.Errorf("top 1 = %+v, want a", top.Spots)
+	}
+}
+
+func TestPredictFallsBackToPrior(t *testing.T) {
+	recs, catalog := fixture()
+	// 条件内没有眼、也没有先验权重时退回阵营先验
+	res := Predict(recs, catalog, Query{Side: 2, FromMin: 50}, Options{PriorWeight: 0}, 0)
+	if res.Wards != 0 {
+		t.Fatalf("%d wards after 50 minutes, want 0", res.Wards)
+	}
+	if !near(res.Spots[0].Probability, 6.5/11.5) || !near(res.Other, 2.5/11.5) {
+		t.Errorf("p(a) %v, other %v; want the side prior", res.Spots[0].Probability, res.Other)
+	}
+	// PriorWeight 为 0 且条件内有眼时只看条件内的实际频率
+	res = Predict(recs, catalog, Query{Side: 2, FromMin: 15, Roshan: model.RoshanDown}, Options{Alpha: 0.5}, 0)
+	if res.Wards != 2 || res.Spots[0].SpotID != "b" || !near(res.Spots[0].Probability, 1) {
+		t.Errorf("down after 15 minutes: %+v, want b with probability 1", res)
+	}
+}
@@ -0,0 +1,196 @@
+// Package region 地图区域定义与坐标 → region_tag 映射。
+// 区域多边形按版本（patch）维护在 data/regions.json，坐标单位为 OpenDota 网格（见 docs/design.md）。
+package region
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/cndotaplan/cndotaplan/internal/coord"
+)
+
+// 区域标签，与 docs/design.md 2.2 一致
+const (
+	Roshan            = "roshan"
+	RadiantJungle     = "radiant_jungle"
+	DireJungle        = "dire_jungle"
+	River             = "river"
+	RadiantHighGround = "radiant_high_ground"
+	DireHighGround    = "dire_high_ground"
+	Outpost           = "outpost"
+	LaneTop           = "lane_top"
+	LaneMid           = "lane_mid"
+	LaneBot           = "lane_bot"
+	Other             = "other"
+)
+
+//go:embed data/regions.json
+var dataFS embed.FS
+
+// Point 网格坐标 [x, y]
+type Point [2]float64
+
+// Region 一个带标签的多边形区域；同一标签可有多个多边形（如两个肉山坑）
+type Region struct {
+	Tag     string  `json:"tag"`
+	Name    string  `json:"name,omitempty"`
+	Polygon []Point `json:"polygon"`
+}
+
+// Map 某一版本的区域表，Regions 按优先级排列，先命中者优先
+type Map struct {
+	Patch   string   `json:"patch"`
+	Regions []Region `json:"regions"`
+}
+
+// File 区域数据文件格式
+type File struct {
+	Version int    `json:"version"`
+	Units   string `json:"units"`
+	Note    string `json:"note,omitempty"`
+	Patches []*Map `json:"patches"`
+}
+
+// Parse 读取区域数据文件
+func Parse(r io.Reader) (*File, error) {
+	var f File
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("region: decode: %w", err)
+	}
+	if len(f.Patches) == 0 {
+		return nil, fmt.Errorf("region: no patches")
+	}
+	for _, m := range f.Patches {
+		for _, reg := range m.Regions {
+			if len(reg.Polygon) < 3 {
+				return nil, fmt.Errorf("region: patch %s tag %s: polygon needs >= 3 points", m.Patch, reg.Tag)
+			}
+		}
+	}
+	sort.Slice(f.Patches, func(i, j int) bool { return coord.ComparePatch(f.Patches[i].Patch, f.Patches[j].Patch) < 0 })
+	return &f, nil
+}
+
+// LoadFile 从外部文件读取区域数据（用于覆盖内置数据）
+func LoadFile(path string) (*File, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	return Parse(fh)
+}
+
+// Builtin 内置的区域数据
+func Builtin() (*File, error) {
+	fh, err := dataFS.Open("data/regions.json")
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	return Parse(fh)
+}
+
+// ForPatch 取适用于 patch 的区域表：不晚于 patch 的最新版本；patch 为空或早于所有版本时用最早/最新的兜底。
+func (f *File) ForPatch(patch string) *Map {
+	if patch == "" {
+		return f.Patches[len(f.Patches)-1]
+	}
+	best := f.Patches[0]
+	for _, m := range f.Patches {
+		if coord.ComparePatch(m.Patch, patch) <= 0 {
+			best = m
+		}
+	}
+	return best
+}
+
+// Load 从内置数据取 patch 对应的区域表，patch 为空时取最新版本
+func Load(patch string) (*Map, error) {
+	f, err := Builtin()
+	if err != nil {
+		return nil, err
+	}
+	return f.ForPatch(patch), nil
+}
+
+// Tag 返回网格坐标 (x, y) 所在区域标签，不在任何区域内时为 Other
+func (m *Map) Tag(x, y float64) string {
+	for _, reg := range m.Regions {
+		if contains(reg.Polygon, x, y) {
+			return reg.Tag
+		}
+	}
+	return Other
+}
+
+// TagIn 与 Tag 相同，但 (x, y) 位于 space 坐标系下
+func (m *Map) TagIn(x, y float64, space coord.Space) string {
+	gx, gy := coord.BoundsFor(m.Patch).Convert(x, y, space, coord.Grid)
+	return m.Tag(gx, gy)
+}
+
+// Distance 网格坐标 (x, y) 到标签为 tag 的最近多边形的距离（网格单位），在多边形内为 0；
+// 该版本没有此标签时为 +Inf
+func (m *Map) Distance(tag string, x, y float64) float64 {
+	best := math.Inf(1)
+	for _, reg := range m.Regions {
+		if reg.Tag != tag {
+			continue
+		}
+		if contains(reg.Polygon, x, y) {
+			return 0
+		}
+		for i, j := 0, len(reg.Polygon)-1; i < len(reg.Polygon); j, i = i, i+1 {
+			best = math.Min(best, segmentDistance(reg.Polygon[j], reg.Polygon[i], x, y))
+		}
+	}
+	return best
+}
+
+// segmentDistance 点 (x, y) 到线段 ab 的距离
+func segmentDistance(a, b Point, x, y float64) float64 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	t := 0.0
+	if l := dx*dx + dy*dy; l > 0 {
+		t = math.Max(0, math.Min(1, ((x-a[0])*dx+(y-a[1])*dy)/l))
+	}
+	return math.Hypot(a[0]+t*dx-x, a[1]+t*dy-y)
+}
+
+// mirrored 地图中心对称后互换的标签：双方野区、高地，上下路
+var mirrored = map[string]string{
+	RadiantJungle:     DireJungle,
+	DireJungle:        RadiantJungle,
+	RadiantHighGround: DireHighGround,
+	DireHighGround:    RadiantHighGround,
+	LaneTop:           LaneBot,
+	LaneBot:           LaneTop,
+}
+
+// MirrorTag 坐标经 coord.Bounds.Mirror 换到对方视角后对应的标签，如 radiant_jungle ↔ dire_jungle；
+// 河道、肉山坑、中路等对称区域不变
+func MirrorTag(tag string) string {
+	if t, ok := mirrored[tag]; ok {
+		return t
+	}
+	return tag
+}
+
+// contains 射线法判断点是否在多边形内（边界上的点视实现可能落在任一侧）
+func contains(poly []Point, x, y float64) bool {
+	in := false
+	for i, j := 0, len(poly)-1; i < len(poly); j, i = i, i+1 {
+		xi, yi := poly[i][0], poly[i][1]
+		xj, yj := poly[j][0], poly[j][1]
+		if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+			in = !in
+		}
+	}
+	return in
+}
@@ -0,0 +1,148 @@
+package region
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/cndotaplan/cndotaplan/internal/coord"
+)
+
+func TestLoad(t *testing.T) {
+	for _, patch := range []string{"", "7.40", "7.45"} {
+		m, err := Load(patch)
+		if err != nil {
+			t.Fatalf("Load(%q): %v", patch, err)
+		}
+		if m.Patch != "7.40" || len(m.Regions) == 0 {
+			t.Errorf("Load(%q) = patch %s, %d regions", patch, m.Patch, len(m.Regions))
+		}
+	}
+}
+
+func TestTag(t *testing.T) {
+	m, err := Load("7.40")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name string
+		x, y float64
+		want string
+	}{
+		{"上路肉山坑", 106, 146, Roshan},
+		{"下路肉山坑", 150, 108, Roshan},
+		{"天辉前哨", 93, 127, Outpost},
+		{"天辉高地", 70, 70, RadiantHighGround},
+		{"夜魇高地", 180, 180, DireHighGround},
+		{"河道", 120, 130, River},
+		{"中路", 110, 110, LaneMid},
+		{"上路", 70, 150, LaneTop},
+		{"下路", 180, 100, LaneBot},
+		{"天辉野区", 100, 120, RadiantJungle},
+		{"夜魇野区", 150, 140, DireJungle},
+		{"地图外", 20, 20, Other},
+		{"地图外（夜魇角）", 200, 200, Other},
+	}
+	for _, c := range cases {
+		if got := m.Tag(c.x, c.y); got != c.want {
+			t.Errorf("%s: Tag(%v, %v) = %s, want %s", c.name, c.x, c.y, got, c.want)
+		}
+		// 同一点换成世界坐标后应得到相同标签
+		wx, wy := coord.BoundsFor(m.Patch).Convert(c.x, c.y, coord.Grid, coord.World)
+		if got := m.TagIn(wx, wy, coord.World); got != c.want {
+			t.Errorf("%s: TagIn(%v, %v, world) = %s, want %s", c.name, wx, wy, got, c.want)
+		}
+		if got := m.TagIn(c.x, c.y, coord.Grid); got != c.want {
+			t.Errorf("%s: TagIn(%v, %v, grid) = %s, want %s", c.name, c.x, c.y, got, c.want)
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	// 凹多边形（L 形），缺口处的点不在内
+	poly := []Point{{0, 0}, {10, 0}, {10, 4}, {4, 4}, {4, 10}, {0, 10}}
+	cases := []struct {
+		x, y float64
+		want bool
+	}{
+		{2, 2, true},
+		{8, 2, true},
+		{2, 8, true},
+		{8, 8, false},
+		{-1, 5, false},
+		{5, 11, false},
+	}
+	for _, c := range cases {
+		if got := contains(poly, c.x, c.y); got != c.want {
+			t.Errorf("contains(%v, %v) = %v, want %v", c.x, c.y, got, c.want)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	m, err := Load("7.40")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name string
+		tag  string
+		x, y float64
+		want float64
+	}{
+		{"坑内", Roshan, 106, 146, 0},
+		{"上路坑正下方", Roshan, 106, 130, 10},
+		{"下路坑右侧拐角", Roshan, 159, 118, 5},
+		{"取两个坑中较近者", Roshan, 150, 95, 7},
+		{"没有此标签", "no_such_tag", 106, 146, math.Inf(1)},
+	}
+	for _, c := range cases {
+		if got := m.Distance(c.tag, c.x, c.y); got != c.want && math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("%s: Distance(%s, %v, %v) = %v, want %v", c.name, c.tag, c.x, c.y, got, c.want)
+		}
+	}
+}
+
+const testFile = `{
+  "version": 1,
+  "units": "opendota_grid",
+  "patches": [
+    {"patch": "7.40", "regions": [{"tag": "roshan", "polygon": [[0,0],[10,0],[10,10]]}]},
+    {"patch": "7.38", "regions": [{"tag": "river", "polygon": [[0,0],[10,0],[10,10]]}]}
+  ]
+}`
+
+func TestForPatch(t *testing.T) {
+	f, err := Parse(strings.NewReader(testFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct{ patch, want string }{
+		{"", "7.40"},
+		{"7.38", "7.38"},
+		{"7.38c", "7.38"},
+		{"7.39", "7.38"},
+		{"7.40", "7.40"},
+		{"7.41", "7.40"},
+		// 早于所有版本时用最早的兜底
+		{"7.30", "7.38"},
+	}
+	for _, c := range cases {
+		if got := f.ForPatch(c.patch).Patch; got != c.want {
+			t.Errorf("ForPatch(%q) = %s, want %s", c.patch, got, c.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, in := range []string{
+		`{"patches": []}`,
+		`{"patches": [{"patch": "7.40", "regions": [{"tag": "river", "polygon": [[0,0],[1,1]]}]}]}`,
+		`not json`,
+	} {
+		if _, err := Parse(strings.NewReader(in)); err == nil {
+			t.Errorf("Parse(%s): want error", in)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+// Package spot 常用眼位：对多场比赛的眼位按世界坐标做 DBSCAN 聚类，得到反复使用的插眼点
+// （质心、半径、使用次数），并维护带稳定 ID 与人工命名的眼位目录文件。
+//
+// 目录文件（Catalog，JSON）由 cmd/spots 生成与更新：重新聚类时新簇按位置对应到已有眼位，
+// 沿用其 ID 与 Label，只有新出现的眼位分配新 ID；Label 可手工填写（如「天辉三角区上方高台」）。
+package spot
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/cndotaplan/cndotaplan/internal/coord"
+	"github.com/cndotaplan/cndotaplan/internal/model"
+	"github.com/cndotaplan/cndotaplan/internal/region"
+)
+
+// Spot 一个常用眼位，坐标与半径为世界单位
+type Spot struct {
+	ID    string  `json:"id"`
+	Label string  `json:"label,omitempty"`
+	X     float64 `json:"x"`
+	Y     float64 `json:"y"`
+	// Radius 成员到质心距离的 90 分位数，不小于 Options.Eps 的一半；Assign 按此判断眼是否落在该眼位
+	Radius    float64 `json:"radius"`
+	Count     int     `json:"count"`
+	Observers int     `json:"observers"`
+	Sentries  int     `json:"sentries"`
+	Region    string  `json:"region,omitempty"`
+}
+
+// Options DBSCAN 参数
+type Options struct {
+	Eps    float64 // 邻域半径（世界单位）
+	MinPts int     // 核心点的最少邻居数（含自身）
+}
+
+// DefaultOptions 约一格视野阻挡格的邻域，至少 5 次使用才算常用眼位
+var DefaultOptions = Options{Eps: 150, MinPts: 5}
+
+// BoundsFunc 某场比赛所在版本的地图边界，用于把网格、归一化坐标的眼换算到世界坐标
+type BoundsFunc func(matchID int64) coord.Bounds
+
+// PatchBounds 按 match_id → 版本（如 storage.Store.MatchPatches 的结果）取各场的地图边界；表中没有的比赛用最新版本
+func PatchBounds(patches map[int64]string) BoundsFunc {
+	return func(matchID int64) coord.Bounds { return coord.BoundsFor(patches[matchID]) }
+}
+
+// worldPos 眼的世界坐标；没有坐标时返回 false
+func worldPos(w *model.WardRecord, bounds BoundsFunc) (float64, float64, bool) {
+	if w.PosX == 0 && w.PosY == 0 {
+		return 0, 0, false
+	}
+	space := coord.Space(w.CoordSpace)
+	if space == "" {
+		space = coord.World
+	}
+	x, y := bounds(w.MatchID).ToWorld(w.PosX, w.PosY, space)
+	return x, y, true
+}
+
+// Cluster 对 records 中有坐标的眼（真假眼一起）做 DBSCAN，返回按使用次数降序的眼位；坐标按 bounds 给出的
+// 各场版本换算到世界坐标。ID 按质心的网格坐标生成（如 "102-087"），需要与已有目录对应时用 Catalog.Merge。
+func Cluster(records []model.WardRecord, bounds BoundsFunc, opts Options) []Spot {
+	if opts.Eps <= 0 {
+		opts.Eps = DefaultOptions.Eps
+	}
+	if opts.MinPts <= 0 {
+		opts.MinPts = DefaultOptions.MinPts
+	}
+	type point struct {
+		x, y  float64
+		ward  *model.WardRecord
+		label int // 0 未访问，-1 噪声，>0 簇编号
+	}
+	var pts []point
+	for i := range records {
+		w := &records[i]
+		if x, y, ok := worldPos(w, bounds); ok {
+			pts = append(pts, point{x: x, y: y, ward: w})
+		}
+	}
+
+	// 按 Eps 分桶，邻域只查相邻 3×3 个桶
+	type cell [2]int
+	cellOf := func(x, y float64) cell { return cell{int(math.Floor(x / opts.Eps)), int(math.Floor(y / opts.Eps))} }
+	buckets := map[cell][]int{}
+	for i, p := range pts {
+		c := cellOf(p.x, p.y)
+		buckets[c] = append(buckets[c], i)
+	}
+	neighbors := func(i int) []int {
+		c := cellOf(pts[i].x, pts[i].y)
+		var out []int
+		for dx := -1; dx <= 1; dx++ {
+			for dy := -1; dy <= 1; dy++ {
+				for _, j := range buckets[cell{c[0] + dx, c[1] + dy}] {
+					if math.Hypot(pts[j].x-pts[i].x, pts[j].y-pts[i].y) <= opts.Eps {
+						out = append(out, j)
+					}
+				}
+			}
+		}
+		return out
+	}
+
+	clusters := 0
+	for i := range pts {
+		if pts[i].label != 0 {
+			continue
+		}
+		nb := neighbors(i)
+		if len(nb) < opts.MinPts {
+			pts[i].label = -1
+			continue
+		}
+		clusters++
+		pts[i].label = clusters
+		queue := nb
+		for len(queue) > 0 {
+			j := queue[0]
+			queue = queue[1:]
+			if pts[j].label == -1 {
+				pts[j].label = clusters // 边界点
+			}
+			if pts[j].label != 0 {
+				continue
+			}
+			pts[j].label = clusters
+			if nb := neighbors(j); len(nb) >= opts.MinPts {
+				queue = append(queue, nb...)
+			}
+		}
+	}
+
+	members := make([][]int, clusters)
+	for i, p := range pts {
+		if p.label > 0 {
+			members[p.label-1] = append(members[p.label-1], i)
+		}
+	}
+	regions, _ := region.Load("")
+	spots := make([]Spot, 0, clusters)
+	for _, idx := range members {
+		s := Spot{Count: len(idx)}
+		for _, i := range idx {
+			s.X += pts[i].x
+			s.Y += pts[i].y
+			if pts[i].ward.WardType == "sentry" {
+				s.Sentries++
+			} else {
+				s.Observers++
+			}
+		}
+		s.X /= float64(len(idx))
+		s.Y /= float64(len(idx))
+		dist := make([]float64, len(idx))
+		for k, i := range idx {
+			dist[k] = math.Hypot(pts[i].x-s.X, pts[i].y-s.Y)
+		}
+		sort.Float64s(dist)
+		s.Radius = math.Max(dist[int(0.9*float64(len(dist)-1))], opts.Eps/2)
+		if regions != nil {
+			s.Region = regions.TagIn(s.X, s.Y, coord.World)
+		}
+		spots = append(spots, s)
+	}
+	sortSpots(spots)
+	assignIDs(spots, nil)
+	return spots
+}
+
+func sortSpots(spots []Spot) {
+	sort.SliceStable(spots, func(i, j int) bool {
+		if spots[i].Count != spots[j].Count {
+			return spots[i].Count > spots[j].Count
+		}
+		if spots[i].X != spots[j].X {
+			return spots[i].X < spots[j].X
+		}
+		return spots[i].Y < spots[j].Y
+	})
+}
+
+// assignIDs 给没有 ID 的眼位按质心网格坐标生成 ID，与 used 及彼此重复时加后缀
+func assignIDs(spots []Spot, used map[string]bool) {
+	if used == nil {
+		used = map[string]bool{}
+	}
+	for i := range spots {
+		if spots[i].ID != "" {
+			used[spots[i].ID] = true
+		}
+	}
+	for i := range spots {
+		s := &spots[i]
+		if s.ID != "" {
+			continue
+		}
+		gx, gy := coord.WorldToGrid(s.X, s.Y)
+		base := fmt.Sprintf("%03d-%03d", int(math.Round(gx)), int(math.Round(gy)))
+		id := base
+		for n := 2; used[id]; n++ {
+			id = fmt.Sprintf("%s-%d", base, n)
+		}
+		s.ID = id
+		used[id] = true
+	}
+}
+
+// Catalog 眼位目录文件
+type Catalog struct {
+	Version int    `json:"version"`
+	Note    string `json:"note,omitempty"`
+	Spots   []Spot `json:"spots"`
+}
+
+// LoadCatalog 读取目录文件；文件不存在时返回空目录
+func LoadCatalog(path string) (*Catalog, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Catalog{Version: 1}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c Catalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("spot: %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Save 写入目录文件（缩进 JSON，便于手工编辑 Label）
+func (c *Catalog) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Merge 用新一次聚类的结果更新目录：按质心距离由近到远一一对应（距离不超过两者半径的较大值），
+// 对应上的沿用目录中的 ID 与 Label、更新位置与计数；新眼位分配新 ID；本次没有出现的旧眼位保留，计数记为 0。
+func (c *Catalog) Merge(found []Spot) {
+	type pair struct {
+		old, new int
+		d        float64
+	}
+	var pairs []pair
+	for i, o := range c.Spots {
+		for j, n := range found {
+			d := math.Hypot(o.X-n.X, o.Y-n.Y)
+			if d <= math.Max(o.Radius, n.Radius) {
+				pairs = append(pairs, pair{i, j, d})
+			}
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].d < pairs[j].d })
+	oldUsed := make([]bool, len(c.Spots))
+	merged := make([]Spot, len(found))
+	copy(merged, found)
+	for j := range merged {
+		merged[j].ID, merged[j].Label = "", ""
+	}
+	newUsed := make([]bool, len(found))
+	for _, p := range pairs {
+		if oldUsed[p.old] || newUsed[p.new] {
+			continue
+		}
+		oldUsed[p.old], newUsed[p.new] = true, true
+		merged[p.new].ID = c.Spots[p.old].ID
+		merged[p.new].Label = c.Spots[p.old].Label
+	}
+	used := map[string]bool{}
+	for i, o := range c.Spots {
+		used[o.ID] = true
+		if !oldUsed[i] {
+			o.Count, o.Observers, o.Sentries = 0, 0, 0
+			merged = append(merged, o)
+		}
+	}
+	assignIDs(merged, used)
+	sortSpots(merged)
+	if c.Version == 0 {
+		c.Version = 1
+	}
+	c.Spots = merged
+}
+
+// Assign 眼所在的眼位 ID：质心距离不超过 Radius 的眼位中最近的一个，没有时为空；坐标按 bounds 换算
+func (c *Catalog) Assign(w *model.WardRecord, bounds BoundsFunc) string {
+	x, y, ok := worldPos(w, bounds)
+	if !ok {
+		return ""
+	}
+	best, bestD := "", math.Inf(1)
+	for _, s := range c.Spots {
+		if d := math.Hypot(s.X-x, s.Y-y); d <= s.Radius && d < bestD {
+			best, bestD = s.ID, d
+		}
+	}
+	return best
+}
+
+// AssignRecords 按目录重写 records 的 SpotID（见 Assign），用于入库前与按新目录重新归类
+func (c *Catalog) AssignRecords(records []model.WardRecord, bounds BoundsFunc) {
+	for i := range records {
+		records[i].SpotID = c.Assign(&records[i], bounds)
+	}
+}
+
+// Spot 按 ID 查找
+func (c *Catalog) Spot(id string) (Spot, bool) {
+	for _, s := range c.Spots {
+		if s.ID == id {
+			return s, true
+		}
+	}
+	return Spot{}, false
+}
+
+// Usage 一个眼位在一组眼中的使用次数
+type Usage struct {
+	SpotID string `json:"spot_id"`
+	Count  int    `json:"count"`
+	// Share 占这组眼中已归入眼位的眼数的比例
+	Share float64 `json:"share"`
+}
+
+// Top 按 SpotID 统计 records 的使用次数，返回前 n 个（n <= 0 为全部），次数相同按 ID 排序；没有 SpotID 的眼不计
+func Top(records []model.WardRecord, n int) []Usage {
+	counts := map[string]int{}
+	total := 0
+	for _, w := range records {
+		if w.SpotID == "" {
+			continue
+		}
+		counts[w.SpotID]++
+		total++
+	}
+	out := make([]Usage, 0, len(counts))
+	for id, k := range counts {
+		out = append(out, Usage{SpotID: id, Count: k, Share: float64(k) / float64(total)})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].SpotID < out[j].SpotID
+	})
+	if n > 0 && len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
@@ -0,0 +1,99 @@
+package spot
+
+import (
+	"testing"
+
+	"github.com/cndotaplan/cndotaplan/internal/coord"
+	"github.com/cndotaplan/cndotaplan/internal/model"
+)
+
+var jitter = [][2]float64{{0, 0}, {20, 0}, {-20, 0}, {0, 20}, {0, -20}, {10, 10}}
+
+// around n 只眼围绕世界坐标 (x, y)
+func around(matchID int64, x, y float64, n int) []model.WardRecord {
+	var out []model.WardRecord
+	for _, d := range jitter[:n] {
+		out = append(out, model.WardRecord{MatchID: matchID, WardType: "observer", PosX: x + d[0], PosY: y + d[1], CoordSpace: string(coord.World)})
+	}
+	return out
+}
+
+// testBounds 第 2 场的眼为归一化坐标，按 0–20000 的边界换算
+func testBounds(matchID int64) coord.Bounds {
+	if matchID == 2 {
+		return coord.Bounds{MaxX: 20000, MaxY: 20000}
+	}
+	return coord.BoundsFor("")
+}
+
+func records(shift float64, withB, withC bool) []model.WardRecord {
+	recs := around(1, 10000+shift, 10000, 3)
+	for _, w := range around(2, 10000+shift, 10000, 6)[3:] {
+		w.PosX, w.PosY, w.CoordSpace = w.PosX/20000, w.PosY/20000, string(coord.Normalized)
+		recs = append(recs, w)
+	}
+	if withB {
+		recs = append(recs, around(1, 14000, 12000, 5)...)
+	}
+	if withC {
+		recs = append(recs, around(1, 8000, 15000, 5)...)
+	}
+	// 噪声与没有坐标的眼
+	return append(recs, model.WardRecord{MatchID: 1, PosX: 5000, PosY: 5000}, model.WardRecord{MatchID: 1})
+}
+
+func TestCluster(t *testing.T) {
+	spots := Cluster(records(0, true, false), testBounds, DefaultOptions)
+	if len(spots) != 2 {
+		t.Fatalf("%d spots, want 2: %+v", len(spots), spots)
+	}
+	a, b := spots[0], spots[1]
+	if a.ID != "078-078" || a.Count != 6 || a.Observers != 6 {
+		t.Errorf("first spot %+v, want 078-078 with 6 observers from both matches", a)
+	}
+	if b.ID != "109-094" || b.Count != 5 {
+		t.Errorf("second spot %+v, want 109-094 with 5 wards", b)
+	}
+	if a.Radius != DefaultOptions.Eps/2 {
+		t.Errorf("radius %v, want the Eps/2 floor", a.Radius)
+	}
+	c := &Catalog{Spots: spots}
+	if id := c.Assign(&model.WardRecord{MatchID: 2, PosX: 0.5, PosY: 0.5, CoordSpace: string(coord.Normalized)}, testBounds); id != a.ID {
+		t.Errorf("Assign normalized ward = %q, want %q", id, a.ID)
+	}
+	if id := c.Assign(&model.WardRecord{MatchID: 1, PosX: 5000, PosY: 5000}, testBounds); id != "" {
+		t.Errorf("Assign far ward = %q, want none", id)
+	}
+}
+
+func TestMergeKeepsIDs(t *testing.T) {
+	c := &Catalog{}
+	c.Merge(Cluster(records(0, true, false), testBounds, DefaultOptions))
+	c.Spots[0].Label = "天辉野区"
+	first, second := c.Spots[0], c.Spots[1]
+
+	// 眼位整体移动 60 单位（质心网格坐标四舍五入后变成 079-078），B 不再出现，新出现 C
+	c.Merge(Cluster(records(60, false, true), testBounds, DefaultOptions))
+	if len(c.Spots) != 3 {
+		t.Fatalf("%d spots after merge, want 3: %+v", len(c.Spots), c.Spots)
+	}
+	moved, ok := c.Spot(first.ID)
+	if !ok || moved.Label != first.Label || moved.X != first.X+60 || moved.Count != 6 {
+		t.Errorf("moved spot %+v, want %s kept with its label at x+60", moved, first.ID)
+	}
+	if gone, ok := c.Spot(second.ID); !ok || gone.Count != 0 {
+		t.Errorf("missing spot %+v, want %s kept with count 0", gone, second.ID)
+	}
+	if c.Spots[1].ID != "063-117" || c.Spots[2].ID != second.ID {
+		t.Errorf("spots %s, %s; want the new spot 063-117 before the unused %s", c.Spots[1].ID, c.Spots[2].ID, second.ID)
+	}
+
+	// 同一份数据再合并一次，ID 不变
+	before := append([]Spot(nil), c.Spots...)
+	c.Merge(Cluster(records(60, false, true), testBounds, DefaultOptions))
+	for i := range before {
+		if c.Spots[i].ID != before[i].ID {
+			t.Errorf("spot %d: ID %s → %s on an identical merge", i, before[i].ID, c.Spots[i].ID)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/cndotaplan/cndotaplan/internal/coord"
+	"github.com/cndotaplan/cndotaplan/internal/model"
+	"github.com/cndotaplan/cndotaplan/internal/region"
+	_ "modernc.org/sqlite" // 纯 Go 实现，无需 cgo
+)
+
+// sqliteMigrations 按顺序执行，已执行的版本记录在 schema_migrations；只能追加，不能修改已发布的条目。
+var sqliteMigrations = []string{
+	// 1: 初始表结构
+	`CREATE TABLE matches (
+		match_id        INTEGER PRIMARY KEY,
+		start_time      INTEGER,
+		league_id       INTEGER NOT NULL DEFAULT 0,
+		radiant_team_id INTEGER NOT NULL DEFAULT 0,
+		dire_team_id    INTEGER NOT NULL DEFAULT 0,
+		patch           TEXT NOT NULL DEFAULT '',
+		created_at      INTEGER NOT NULL
+	);
+	CREATE TABLE ward_events (
+		id             INTEGER PRIMARY KEY AUTOINCREMENT,
+		match_id       INTEGER NOT NULL REFERENCES matches(match_id) ON DELETE CASCADE,
+		team_id        INTEGER NOT NULL,
+		ward_type      TEXT NOT NULL,
+		player_slot    INTEGER NOT NULL DEFAULT -1,
+		account_id     INTEGER NOT NULL DEFAULT 0,
+		player_name    TEXT NOT NULL DEFAULT '',
+		hero_id        INTEGER NOT NULL DEFAULT 0,
+		hero_name      TEXT NOT NULL DEFAULT '',
+		pos_x          REAL NOT NULL,
+		pos_y          REAL NOT NULL,
+		coord_space    TEXT NOT NULL DEFAULT '',
+		game_time_sec  REAL NOT NULL,
+		duration_sec   REAL NOT NULL,
+		is_denied      INTEGER NOT NULL DEFAULT 0,
+		alive_at_end   INTEGER NOT NULL DEFAULT 0,
+		removal_cause  TEXT NOT NULL DEFAULT '',
+		killer_unit    TEXT NOT NULL DEFAULT '',
+		killer_team    INTEGER NOT NULL DEFAULT 0,
+		killer_is_hero INTEGER NOT NULL DEFAULT 0,
+		bounty_gold    INTEGER NOT NULL DEFAULT 0,
+		bounty_xp      INTEGER NOT NULL DEFAULT 0,
+		region_tag     TEXT NOT NULL DEFAULT '',
+		created_at     INTEGER NOT NULL
+	);
+	CREATE INDEX ward_events_match ON ward_events(match_id);
+	CREATE INDEX ward_events_team_type ON ward_events(team_id, ward_type);`,
+	// 2: 录像中的比赛元数据（parser.ExtractMatch）
+	`ALTER TABLE matches ADD COLUMN radiant_team_tag TEXT NOT NULL DEFAULT '';
+	ALTER TABLE matches ADD COLUMN dire_team_tag TEXT NOT NULL DEFAULT '';
+	ALTER TABLE matches ADD COLUMN winner INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE matches ADD COLUMN duration_sec REAL NOT NULL DEFAULT 0;
+	CREATE INDEX matches_patch ON matches(patch);
+	CREATE INDEX matches_start_time ON matches(start_time);`,
+	// 3: 眼位以外的视野事件（model.VisionEvent）
+	`CREATE TABLE vision_events (
+		id            INTEGER PRIMARY KEY AUTOINCREMENT,
+		match_id      INTEGER NOT NULL REFERENCES matches(match_id) ON DELETE CASCADE,
+		kind          TEXT NOT NULL,
+		team_id       INTEGER NOT NULL,
+		player_slot   INTEGER NOT NULL DEFAULT -1,
+		account_id    INTEGER NOT NULL DEFAULT 0,
+		player_name   TEXT NOT NULL DEFAULT '',
+		hero_name     TEXT NOT NULL DEFAULT '',
+		pos_x         REAL NOT NULL,
+		pos_y         REAL NOT NULL,
+		coord_space   TEXT NOT NULL DEFAULT '',
+		game_time_sec REAL NOT NULL,
+		duration_sec  REAL NOT NULL,
+		alive_at_end  INTEGER NOT NULL DEFAULT 0,
+		heroes        INTEGER NOT NULL DEFAULT 0,
+		region_tag    TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX vision_events_match ON vision_events(match_id);`,
+	// 4: 英雄位置采样（model.HeroTrack），每名英雄一行
+	`CREATE TABLE hero_tracks (
+		match_id     INTEGER NOT NULL REFERENCES matches(match_id) ON DELETE CASCADE,
+		player_slot  INTEGER NOT NULL,
+		team_id      INTEGER NOT NULL,
+		hero_name    TEXT NOT NULL DEFAULT '',
+		start_sec    REAL NOT NULL,
+		interval_sec REAL NOT NULL,
+		xs           BLOB NOT NULL,
+		ys           BLOB NOT NULL,
+		alive        BLOB NOT NULL,
+		PRIMARY KEY (match_id, player_slot)
+	);`,
+	// 5: 眼位视野统计（vision.Spotted）与英雄隐身位图
+	`ALTER TABLE ward_events ADD COLUMN spotted_hero_sec REAL NOT NULL DEFAULT 0;
+	ALTER TABLE ward_events ADD COLUMN spotted_heroes INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE ward_events ADD COLUMN revealed_wards INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE hero_tracks ADD COLUMN invisible BLOB NOT NULL DEFAULT x'';`,
+	// 6: 砍树与临时树（model.TreeEvent）
+	`CREATE TABLE tree_events (
+		id            INTEGER PRIMARY KEY AUTOINCREMENT,
+		match_id      INTEGER NOT NULL REFERENCES matches(match_id) ON DELETE CASCADE,
+		kind          TEXT NOT NULL,
+		cause         TEXT NOT NULL DEFAULT '',
+		team_id       INTEGER NOT NULL DEFAULT 0,
+		player_slot   INTEGER NOT NULL DEFAULT -1,
+		hero_name     TEXT NOT NULL DEFAULT '',
+		pos_x         REAL NOT NULL,
+		pos_y         REAL NOT NULL,
+		coord_space   TEXT NOT NULL DEFAULT '',
+		radius        REAL NOT NULL DEFAULT 0,
+		game_time_sec REAL NOT NULL,
+		duration_sec  REAL NOT NULL
+	);
+	CREATE INDEX tree_events_match ON tree_events(match_id);`,
+	// 7: 常用眼位（internal/spot）
+	`ALTER TABLE ward_events ADD COLUMN spot_id TEXT NOT NULL DEFAULT '';
+	CREATE INDEX ward_events_spot ON ward_events(spot_id);`,
+	// 8: 插眼时的肉山状态
+	`ALTER TABLE ward_events ADD COLUMN roshan_state TEXT NOT NULL DEFAULT '';`,
+	// 9: 截断/损坏录像的部分结果
+	`ALTER TABLE matches ADD COLUMN partial INTEGER NOT NULL DEFAULT 0;`,
+}
+
+func sqlitePlaceholder(int) string { return "?" }
+
+var sqliteDialect = dialect{ph: sqlitePlaceholder, startTime: "start_time"}
+
+// SQLite 嵌入式存储，单文件数据库，无需服务端
+type SQLite struct {
+	db *sql.DB
+}
+
+// OpenSQLite 打开（不存在则创建）path 处的数据库并执行未完成的迁移
+func OpenSQLite(path string) (*SQLite, error) {
+	// _pragma 由 modernc.org/sqlite 在每个连接上执行：外键级联删除需显式开启
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	s := &SQLite{db: db}
+	if err := migrate(context.Background(), db, sqliteMigrations, sqlitePlaceholder); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// SaveMatch 在一个事务内替换该场比赛的 matches 行与全部 ward_events 行
+func (s *SQLite) SaveMatch(ctx context.Context, m Match, wards []model.WardRecord) error {
+	return inTx(ctx, s.db, func(tx *sql.Tx) error { return s.saveMatch(ctx, tx, m, wards) })
+}
+
+// SaveReplay 在一个事务内写入整场录像的解析结果
+func (s *SQLite) SaveReplay(ctx context.Context, m Match, r Replay) error {
+	return inTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.saveMatch(ctx, tx, m, r.Wards); err != nil {
+			return err
+		}
+		return saveReplayEvents(ctx, tx, sqlitePlaceholder, m.MatchID, r)
+	})
+}
+
+func (s *SQLite) saveMatch(ctx context.Context, tx *sql.Tx, m Match, wards []model.WardRecord) error {
+	now := time.Now().Unix()
+	var startTime interface{}
+	if !m.StartTime.IsZero() {
+		startTime = m.StartTime.Unix()
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM ward_events WHERE match_id = ?`, m.MatchID); err != nil {
+		return fmt.Errorf("storage: delete wards: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO matches (match_id, start_time, league_id, radiant_team_id, dire_team_id, patch,
+			radiant_team_tag, dire_team_tag, winner, duration_sec, partial, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(match_id) DO UPDATE SET start_time = excluded.start_time, league_id = excluded.league_id,
+			radiant_team_id = excluded.radiant_team_id, dire_team_id = excluded.dire_team_id, patch = excluded.patch,
+			radiant_team_tag = excluded.radiant_team_tag, dire_team_tag = excluded.dire_team_tag,
+			winner = excluded.winner, duration_sec = excluded.duration_sec, partial = excluded.partial`,
+		m.MatchID, startTime, m.LeagueID, m.RadiantTeamID, m.DireTeamID, m.Patch,
+		m.RadiantTeamTag, m.DireTeamTag, m.Winner, m.DurationSec, m.Partial, now); err != nil {
+		return fmt.Errorf("storage: upsert match: %w", err)
+	}
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO ward_events (`+wardColumns+`, created_at)
+		VALUES (`+placeholders(wardColumnCount+1, sqlitePlaceholder)+`)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i := range wards {
+		w := wards[i]
+		w.MatchID = m.MatchID
+		if _, err := stmt.ExecContext(ctx, append(wardValues(&w), now)...); err != nil {
+			return fmt.Errorf("storage: insert ward: %w", err)
+		}
+	}
+	return nil
+}
+
+// HasMatch 该场是否已完整入库
+func (s *SQLite) HasMatch(ctx context.Context, matchID int64) (bool, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM matches WHERE match_id = ? AND partial = 0`, matchID).Scan(&n)
+	return n > 0, err
+}
+
+// MatchPatches 各场的版本
+func (s *SQLite) MatchPatches(ctx context.Context, matchIDs []int64) (map[int64]string, error) {
+	return matchPatches(ctx, s.db, sqliteDialect, matchIDs)
+}
+
+// Wards 按条件查询眼位，按 match_id、插眼时间排序
+func (s *SQLite) Wards(ctx context.Context, f WardFilter) ([]model.WardRecord, error) {
+	where, args := f.where(sqliteDialect, nil)
+	rows, err := s.db.QueryContext(ctx, `SELECT `+wardColumns+` FROM ward_events`+where+` ORDER BY match_id, game_time_sec, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanWards(rows)
+}
+
+// WardsWithin SQLite 没有空间索引：先按条件取出再在 Go 里按距离过滤
+func (s *SQLite) WardsWithin(ctx context.Context, x, y, radius float64, f WardFilter) ([]model.WardRecord, error) {
+	all, err := s.Wards(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	pos, err := s.worldPositions(ctx, all)
+	if err != nil {
+		return nil, err
+	}
+	var out []model.WardRecord
+	for i := range all {
+		wx, wy := pos[i][0], pos[i][1]
+		if (wx-x)*(wx-x)+(wy-y)*(wy-y) <= radius*radius {
+			out = append(out, all[i])
+		}
+	}
+	return out, nil
+}
+
+// WardsNearRegion 与 WardsWithin 一样在 Go 里过滤：按内置区域表计算眼位到多边形的距离
+func (s *SQLite) WardsNearRegion(ctx context.Context, patch, tag string, radius float64, f WardFilter) ([]model.WardRecord, error) {
+	m, err := region.Load(patch)
+	if err != nil {
+		return nil, err
+	}
+	all, err := s.Wards(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	pos, err := s.worldPositions(ctx, all)
+	if err != nil {
+		return nil, err
+	}
+	var out []model.WardRecord
+	for i := range all {
+		gx, gy := coord.WorldToGrid(pos[i][0], pos[i][1])
+		if m.Distance(tag, gx, gy)*coord.GridUnit <= radius {
+			out = append(out, all[i])
+		}
+	}
+	return out, nil
+}
+
+// worldPositions 按各场版本换算 wards 的世界坐标
+func (s *SQLite) worldPositions(ctx context.Context, wards []model.WardRecord) ([][2]float64, error) {
+	if len(wards) == 0 {
+		return nil, nil
+	}
+	patches, err := s.MatchPatches(ctx, matchIDsOf(wards))
+	if err != nil {
+		return nil, err
+	}
+	return worldPositions(wards, patches), nil
+}
+
+// SaveVision 替换该场的全部视野事件
+func (s *SQLite) SaveVision(ctx context.Context, matchID int64, events []model.VisionEvent) error {
+	return inTx(ctx, s.db, func(tx *sql.Tx) error { return saveVision(ctx, tx, sqlitePlaceholder, matchID, events) })
+}
+
+// Vision 该场的视野事件
+func (s *SQLite) Vision(ctx context.Context, matchID int64) ([]model.VisionEvent, error) {
+	return queryVision(ctx, s.db, sqlitePlaceholder, matchID)
+}
+
+// SaveTracks 替换该场的英雄位置采样
+func (s *SQLite) SaveTracks(ctx context.Context, matchID int64, tracks []model.HeroTrack) error {
+	return inTx(ctx, s.db, func(tx *sql.Tx) error { return saveTracks(ctx, tx, sqlitePlaceholder, matchID, tracks) })
+}
+
+// Tracks 该场的英雄位置采样
+func (s *SQLite) Tracks(ctx context.Context, matchID int64) ([]model.HeroTrack, error) {
+	return queryTracks(ctx, s.db, sqlitePlaceholder, matchID)
+}
+
+// SaveTrees 替换该场的砍树与临时树
+func (s *SQLite) SaveTrees(ctx context.Context, matchID int64, events []model.TreeEvent) error {
+	return inTx(ctx, s.db, func(tx *sql.Tx) error { return saveTrees(ctx, tx, sqlitePlaceholder, matchID, events) })
+}
+
+// Trees 该场的砍树与临时树
+func (s *SQLite) Trees(ctx context.Context, matchID int64) ([]model.TreeEvent, error) {
+	return queryTrees(ctx, s.db, sqlitePlaceholder, matchID)
+}
+
+// AssignSpots 重新计算眼位的 spot_id
+func (s *SQLite) AssignSpots(ctx context.Context, f WardFilter, assign func(*model.WardRecord) string) (int, error) {
+	return assignSpots(ctx, s.db, sqliteDialect, f, assign)
+}
+
+// Close 关闭数据库
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,572 @@
+// Package storage 眼位与比赛元数据的持久化，表结构见 docs/design.md 第 2 节（ward_events、matches）。
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cndotaplan/cndotaplan/internal/coord"
+	"github.com/cndotaplan/cndotaplan/internal/model"
+)
+
+// Match matches 表一行
+type Match struct {
+	MatchID        int64
+	StartTime      time.Time // 未知时为零值
+	LeagueID       int64
+	RadiantTeamID  int64
+	DireTeamID     int64
+	Patch          string
+	RadiantTeamTag string
+	DireTeamTag    string
+	Winner         int32   // 2=天辉 3=夜魇，未知为 0
+	DurationSec    float64 // 未知为 0
+	// Partial 录像截断/损坏，只保存了截断前的部分；HasMatch 不把它算作已入库，完整解析后 SaveMatch 会替换
+	Partial bool
+}
+
+// MatchFromInfo 录像解析出的比赛元数据转为 matches 表一行
+func MatchFromInfo(info model.MatchInfo) Match {
+	m := Match{
+		MatchID:        info.MatchID,
+		LeagueID:       info.LeagueID,
+		RadiantTeamID:  info.RadiantTeam.ID,
+		DireTeamID:     info.DireTeam.ID,
+		Patch:          info.Patch,
+		RadiantTeamTag: info.RadiantTeam.Tag,
+		DireTeamTag:    info.DireTeam.Tag,
+		Winner:         info.Winner,
+		DurationSec:    info.DurationSec,
+	}
+	if info.StartTime > 0 {
+		m.StartTime = time.Unix(info.StartTime, 0).UTC()
+	}
+	return m
+}
+
+// WardFilter 查询 ward_events 的条件，零值字段不参与过滤
+type WardFilter struct {
+	MatchIDs []int64
+	TeamID   int32
+	WardType string
+	// SpotID 只取该常用眼位（internal/spot）的眼
+	SpotID string
+	// ProTeamID 只取职业战队在各场所属一方的眼位（按 matches 表的 radiant_team_id / dire_team_id）
+	ProTeamID int64
+	// 以下按 matches 表过滤：版本、开始时间 [Since, Until)；未记录开始时间的比赛不会命中时间条件
+	Patch string
+	Since time.Time
+	Until time.Time
+	// LastMatches > 0 时只取满足上述条件（含 ProTeamID 参赛）的最近 N 场，按开始时间倒序，未知开始时间的排在最后
+	LastMatches int
+}
+
+// Open 按 driver 打开存储后端："sqlite"（dsn 为文件路径）或 "postgres"（dsn 为连接串，需要 PostGIS）
+func Open(driver, dsn string) (Store, error) {
+	switch driver {
+	case "sqlite", "":
+		return OpenSQLite(dsn)
+	case "postgres":
+		return OpenPostgres(dsn)
+	default:
+		return nil, fmt.Errorf("storage: unknown driver %q", driver)
+	}
+}
+
+// Replay 一场录像的全部解析结果，由 SaveReplay 一次写入
+type Replay struct {
+	Wards  []model.WardRecord
+	Vision []model.VisionEvent
+	Trees  []model.TreeEvent
+	// Tracks 为 nil 时不改动库中已有的英雄位置采样（本次未采样）
+	Tracks []model.HeroTrack
+}
+
+// Store 存储后端。SaveMatch 以 match_id 为单位幂等：重复写入同一场会先删除旧的眼位行再插入。
+type Store interface {
+	SaveMatch(ctx context.Context, m Match, wards []model.WardRecord) error
+	// SaveReplay 在一个事务内完成 SaveMatch、SaveVision、SaveTrees 与（Tracks 不为 nil 时）SaveTracks，
+	// 中途失败不会留下只写了一半的比赛
+	SaveReplay(ctx context.Context, m Match, r Replay) error
+	// HasMatch 该场是否已完整入库；只有部分结果（Match.Partial）的比赛返回 false
+	HasMatch(ctx context.Context, matchID int64) (bool, error)
+	// MatchPatches matches 表中各场的版本（match_id → patch）；matchIDs 为空时取全部比赛。
+	// 多个版本的眼位混在一起时，按此取各场的地图边界换算坐标（coord.BoundsFor）
+	MatchPatches(ctx context.Context, matchIDs []int64) (map[int64]string, error)
+	Wards(ctx context.Context, f WardFilter) ([]model.WardRecord, error)
+	// WardsWithin 查询世界坐标 (x, y) 半径 radius（世界单位）内的眼位
+	WardsWithin(ctx context.Context, x, y, radius float64, f WardFilter) ([]model.WardRecord, error)
+	// WardsNearRegion 查询距 patch 版本（取不晚于 patch 的最新区域表，见 region.Load）中标签为 tag 的
+	// 任一区域多边形 radius（世界单位）以内的眼位，如 WardsNearRegion(ctx, "7.40", region.Roshan, 600, WardFilter{WardType: "observer"})
+	WardsNearRegion(ctx context.Context, patch, tag string, radius float64, f WardFilter) ([]model.WardRecord, error)
+	// SaveVision 替换该场（须已 SaveMatch）的全部视野事件
+	SaveVision(ctx context.Context, matchID int64, events []model.VisionEvent) error
+	// Vision 该场的视野事件，按开始时间排序
+	Vision(ctx context.Context, matchID int64) ([]model.VisionEvent, error)
+	// SaveTracks 替换该场（须已 SaveMatch）的英雄位置采样
+	SaveTracks(ctx context.Context, matchID int64, tracks []model.HeroTrack) error
+	// Tracks 该场的英雄位置采样，按 player_slot 排序；未采样时为空
+	Tracks(ctx context.Context, matchID int64) ([]model.HeroTrack, error)
+	// SaveTrees 替换该场（须已 SaveMatch）的砍树与临时树
+	SaveTrees(ctx context.Context, matchID int64, events []model.TreeEvent) error
+	// Trees 该场的砍树与临时树，按时间排序
+	Trees(ctx context.Context, matchID int64) ([]model.TreeEvent, error)
+	// AssignSpots 按 assign 的结果（常用眼位 ID，见 internal/spot）更新满足 f 的眼位的 spot_id，返回改动的行数
+	AssignSpots(ctx context.Context, f WardFilter, assign func(*model.WardRecord) string) (int, error)
+	Close() error
+}
+
+// inTx 在一个事务内执行 fn，fn 返回错误时回滚
+func inTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// saveReplayEvents 两种方言共用：在 tx 内替换该场的视野事件、树与（不为 nil 时）英雄位置采样
+func saveReplayEvents(ctx context.Context, tx *sql.Tx, ph func(int) string, matchID int64, r Replay) error {
+	if err := saveVision(ctx, tx, ph, matchID, r.Vision); err != nil {
+		return err
+	}
+	if err := saveTrees(ctx, tx, ph, matchID, r.Trees); err != nil {
+		return err
+	}
+	if r.Tracks != nil {
+		return saveTracks(ctx, tx, ph, matchID, r.Tracks)
+	}
+	return nil
+}
+
+// migrate 依次执行尚未执行的迁移，每条迁移与其版本记录在同一事务内提交；ph 为方言的参数占位符
+func migrate(ctx context.Context, db *sql.DB, migrations []string, ph func(int) string) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, applied_at BIGINT NOT NULL)`); err != nil {
+		return fmt.Errorf("storage: create schema_migrations: %w", err)
+	}
+	var current int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("storage: read schema version: %w", err)
+	}
+	for i := current; i < len(migrations); i++ {
+		if err := applyMigration(ctx, db, i+1, migrations[i], ph); err != nil {
+			return fmt.Errorf("storage: migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, version int, stmt string, ph func(int) string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, stmt); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES (`+ph(1)+`, `+ph(2)+`)`, version, time.Now().Unix()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// wardColumns ward_events 中与 model.WardRecord 对应的列，顺序与 wardValues / scanWards 一致
+const wardColumns = `match_id, team_id, ward_type, player_slot, account_id, player_name, hero_id, hero_name,
+	pos_x, pos_y, coord_space, game_time_sec, duration_sec, is_denied, alive_at_end, removal_cause,
+	killer_unit, killer_team, killer_is_hero, bounty_gold, bounty_xp, region_tag,
+	spotted_hero_sec, spotted_heroes, revealed_wards, spot_id, roshan_state`
+
+const wardColumnCount = 27
+
+func wardValues(w *model.WardRecord) []interface{} {
+	return []interface{}{
+		w.MatchID, w.TeamID, w.WardType, w.PlayerSlot, w.AccountID, w.PlayerName, w.HeroID, w.HeroName,
+		w.PosX, w.PosY, w.CoordSpace, w.GameTimeSec, w.DurationSec, w.IsDenied, w.AliveAtEnd, w.RemovalCause,
+		w.KillerUnit, w.KillerTeam, w.KillerIsHero, w.BountyGold, w.BountyXP, w.RegionTag,
+		w.SpottedHeroSec, w.SpottedHeroes, w.RevealedWards, w.SpotID, w.RoshanState,
+	}
+}
+
+// wardDest wardColumns 各列的 Scan 目标
+func wardDest(w *model.WardRecord) []interface{} {
+	return []interface{}{
+		&w.MatchID, &w.TeamID, &w.WardType, &w.PlayerSlot, &w.AccountID, &w.PlayerName, &w.HeroID, &w.HeroName,
+		&w.PosX, &w.PosY, &w.CoordSpace, &w.GameTimeSec, &w.DurationSec, &w.IsDenied, &w.AliveAtEnd, &w.RemovalCause,
+		&w.KillerUnit, &w.KillerTeam, &w.KillerIsHero, &w.BountyGold, &w.BountyXP, &w.RegionTag,
+		&w.SpottedHeroSec, &w.SpottedHeroes, &w.RevealedWards, &w.SpotID, &w.RoshanState,
+	}
+}
+
+func scanWards(rows *sql.Rows) ([]model.WardRecord, error) {
+	var out []model.WardRecord
+	for rows.Next() {
+		var w model.WardRecord
+		if err := rows.Scan(wardDest(&w)...); err != nil {
+			return nil, err
+		}
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+// matchPatches 两种方言共用
+func matchPatches(ctx context.Context, db *sql.DB, d dialect, matchIDs []int64) (map[int64]string, error) {
+	where, args := WardFilter{MatchIDs: matchIDs}.where(d, nil)
+	rows, err := db.QueryContext(ctx, `SELECT match_id, patch FROM matches`+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var patch string
+		if err := rows.Scan(&id, &patch); err != nil {
+			return nil, err
+		}
+		out[id] = patch
+	}
+	return out, rows.Err()
+}
+
+// assignSpots 两种方言共用：按 assign 重新计算满足 f 的眼位的 spot_id，只更新有变化的行
+func assignSpots(ctx context.Context, db *sql.DB, d dialect, f WardFilter, assign func(*model.WardRecord) string) (int, error) {
+	where, args := f.where(d, nil)
+	rows, err := db.QueryContext(ctx, `SELECT id, `+wardColumns+` FROM ward_events`+where, args...)
+	if err != nil {
+		return 0, err
+	}
+	type change struct {
+		id     int64
+		spotID string
+	}
+	var changes []change
+	for rows.Next() {
+		var id int64
+		var w model.WardRecord
+		if err := rows.Scan(append([]interface{}{&id}, wardDest(&w)...)...); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if s := assign(&w); s != w.SpotID {
+			changes = append(changes, change{id, s})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, `UPDATE ward_events SET spot_id = `+d.ph(1)+` WHERE id = `+d.ph(2))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	for _, c := range changes {
+		if _, err := stmt.ExecContext(ctx, c.spotID, c.id); err != nil {
+			return 0, fmt.Errorf("storage: update spot: %w", err)
+		}
+	}
+	return len(changes), tx.Commit()
+}
+
+// dialect 查询中与数据库方言相关的部分
+type dialect struct {
+	ph        func(int) string // 第 i 个（从 1 开始）参数占位符
+	startTime string           // 把 matches.start_time 转为 Unix 秒的表达式
+}
+
+// visionColumns vision_events 中与 model.VisionEvent 对应的列，顺序与 visionValues / scanVision 一致
+const visionColumns = `match_id, kind, team_id, player_slot, account_id, player_name, hero_name,
+	pos_x, pos_y, coord_space, game_time_sec, duration_sec, alive_at_end, heroes, region_tag`
+
+const visionColumnCount = 15
+
+func visionValues(v *model.VisionEvent) []interface{} {
+	return []interface{}{
+		v.MatchID, v.Kind, v.TeamID, v.PlayerSlot, v.AccountID, v.PlayerName, v.HeroName,
+		v.PosX, v.PosY, v.CoordSpace, v.GameTimeSec, v.DurationSec, v.AliveAtEnd, v.Heroes, v.RegionTag,
+	}
+}
+
+func scanVision(rows *sql.Rows) ([]model.VisionEvent, error) {
+	var out []model.VisionEvent
+	for rows.Next() {
+		var v model.VisionEvent
+		if err := rows.Scan(
+			&v.MatchID, &v.Kind, &v.TeamID, &v.PlayerSlot, &v.AccountID, &v.PlayerName, &v.HeroName,
+			&v.PosX, &v.PosY, &v.CoordSpace, &v.GameTimeSec, &v.DurationSec, &v.AliveAtEnd, &v.Heroes, &v.RegionTag,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// saveVision 两种方言共用：在 tx 内删除旧行再逐条插入
+func saveVision(ctx context.Context, tx *sql.Tx, ph func(int) string, matchID int64, events []model.VisionEvent) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM vision_events WHERE match_id = `+ph(1), matchID); err != nil {
+		return fmt.Errorf("storage: delete vision: %w", err)
+	}
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO vision_events (`+visionColumns+`) VALUES (`+placeholders(visionColumnCount, ph)+`)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i := range events {
+		v := events[i]
+		v.MatchID = matchID
+		if _, err := stmt.ExecContext(ctx, visionValues(&v)...); err != nil {
+			return fmt.Errorf("storage: insert vision: %w", err)
+		}
+	}
+	return nil
+}
+
+func queryVision(ctx context.Context, db *sql.DB, ph func(int) string, matchID int64) ([]model.VisionEvent, error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+visionColumns+` FROM vision_events WHERE match_id = `+ph(1)+` ORDER BY game_time_sec, id`, matchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanVision(rows)
+}
+
+// treeColumns tree_events 中与 model.TreeEvent 对应的列，顺序与 treeValues / queryTrees 一致
+const treeColumns = `match_id, kind, cause, team_id, player_slot, hero_name, pos_x, pos_y, coord_space, radius, game_time_sec, duration_sec`
+
+const treeColumnCount = 12
+
+func treeValues(e *model.TreeEvent) []interface{} {
+	return []interface{}{
+		e.MatchID, e.Kind, e.Cause, e.TeamID, e.PlayerSlot, e.HeroName, e.PosX, e.PosY, e.CoordSpace, e.Radius, e.GameTimeSec, e.DurationSec,
+	}
+}
+
+// saveTrees 两种方言共用：在 tx 内删除旧行再逐条插入
+func saveTrees(ctx context.Context, tx *sql.Tx, ph func(int) string, matchID int64, events []model.TreeEvent) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM tree_events WHERE match_id = `+ph(1), matchID); err != nil {
+		return fmt.Errorf("storage: delete trees: %w", err)
+	}
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO tree_events (`+treeColumns+`) VALUES (`+placeholders(treeColumnCount, ph)+`)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i := range events {
+		e := events[i]
+		e.MatchID = matchID
+		if _, err := stmt.ExecContext(ctx, treeValues(&e)...); err != nil {
+			return fmt.Errorf("storage: insert tree: %w", err)
+		}
+	}
+	return nil
+}
+
+func queryTrees(ctx context.Context, db *sql.DB, ph func(int) string, matchID int64) ([]model.TreeEvent, error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+treeColumns+` FROM tree_events WHERE match_id = `+ph(1)+` ORDER BY game_time_sec, id`, matchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.TreeEvent
+	for rows.Next() {
+		var e model.TreeEvent
+		if err := rows.Scan(&e.MatchID, &e.Kind, &e.Cause, &e.TeamID, &e.PlayerSlot, &e.HeroName,
+			&e.PosX, &e.PosY, &e.CoordSpace, &e.Radius, &e.GameTimeSec, &e.DurationSec); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// saveTracks 两种方言共用，在 tx 内替换；坐标序列以小端 int16 存为二进制列
+func saveTracks(ctx context.Context, tx *sql.Tx, ph func(int) string, matchID int64, tracks []model.HeroTrack) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM hero_tracks WHERE match_id = `+ph(1), matchID); err != nil {
+		return fmt.Errorf("storage: delete tracks: %w", err)
+	}
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO hero_tracks (match_id, player_slot, team_id, hero_name, start_sec, interval_sec, xs, ys, alive, invisible)
+		VALUES (`+placeholders(10, ph)+`)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i := range tracks {
+		t := &tracks[i]
+		if _, err := stmt.ExecContext(ctx, matchID, t.PlayerSlot, t.TeamID, t.HeroName, t.StartSec, t.IntervalSec,
+			encodeInt16s(t.X), encodeInt16s(t.Y), nonNilBytes(t.Alive), nonNilBytes(t.Invisible)); err != nil {
+			return fmt.Errorf("storage: insert track: %w", err)
+		}
+	}
+	return nil
+}
+
+func queryTracks(ctx context.Context, db *sql.DB, ph func(int) string, matchID int64) ([]model.HeroTrack, error) {
+	rows, err := db.QueryContext(ctx, `SELECT player_slot, team_id, hero_name, start_sec, interval_sec, xs, ys, alive, invisible
+		FROM hero_tracks WHERE match_id = `+ph(1)+` ORDER BY player_slot`, matchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.HeroTrack
+	for rows.Next() {
+		t := model.HeroTrack{MatchID: matchID}
+		var xs, ys []byte
+		if err := rows.Scan(&t.PlayerSlot, &t.TeamID, &t.HeroName, &t.StartSec, &t.IntervalSec, &xs, &ys, &t.Alive, &t.Invisible); err != nil {
+			return nil, err
+		}
+		t.X, t.Y = decodeInt16s(xs), decodeInt16s(ys)
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// nonNilBytes nil 会写成 NULL，换成空切片
+func nonNilBytes(b []byte) []byte {
+	if b == nil {
+		return []byte{}
+	}
+	return b
+}
+
+func encodeInt16s(v []int16) []byte {
+	b := make([]byte, 2*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint16(b[2*i:], uint16(x))
+	}
+	return b
+}
+
+func decodeInt16s(b []byte) []int16 {
+	v := make([]int16, len(b)/2)
+	for i := range v {
+		v[i] = int16(binary.LittleEndian.Uint16(b[2*i:]))
+	}
+	return v
+}
+
+// where 生成 WHERE 子句。args 为已占用的参数（其占位符已写在 extra 条件里）。
+func (f WardFilter) where(d dialect, args []interface{}, extra ...string) (string, []interface{}) {
+	ph := d.ph
+	conds := append([]string(nil), extra...)
+	if len(f.MatchIDs) > 0 {
+		var marks []string
+		for _, id := range f.MatchIDs {
+			args = append(args, id)
+			marks = append(marks, ph(len(args)))
+		}
+		conds = append(conds, "match_id IN ("+strings.Join(marks, ", ")+")")
+	}
+	if f.TeamID != 0 {
+		args = append(args, f.TeamID)
+		conds = append(conds, "team_id = "+ph(len(args)))
+	}
+	if f.WardType != "" {
+		args = append(args, f.WardType)
+		conds = append(conds, "ward_type = "+ph(len(args)))
+	}
+	if f.SpotID != "" {
+		args = append(args, f.SpotID)
+		conds = append(conds, "spot_id = "+ph(len(args)))
+	}
+	if f.ProTeamID != 0 {
+		args = append(args, f.ProTeamID, f.ProTeamID)
+		conds = append(conds, "((team_id = 2 AND match_id IN (SELECT match_id FROM matches WHERE radiant_team_id = "+ph(len(args)-1)+")) OR "+
+			"(team_id = 3 AND match_id IN (SELECT match_id FROM matches WHERE dire_team_id = "+ph(len(args))+")))")
+	}
+	var matchConds []string
+	if f.ProTeamID != 0 && f.LastMatches > 0 {
+		args = append(args, f.ProTeamID, f.ProTeamID)
+		matchConds = append(matchConds, "(radiant_team_id = "+ph(len(args)-1)+" OR dire_team_id = "+ph(len(args))+")")
+	}
+	if f.Patch != "" {
+		args = append(args, f.Patch)
+		matchConds = append(matchConds, "patch = "+ph(len(args)))
+	}
+	if !f.Since.IsZero() {
+		args = append(args, f.Since.Unix())
+		matchConds = append(matchConds, d.startTime+" >= "+ph(len(args)))
+	}
+	if !f.Until.IsZero() {
+		args = append(args, f.Until.Unix())
+		matchConds = append(matchConds, d.startTime+" < "+ph(len(args)))
+	}
+	if len(matchConds) > 0 || f.LastMatches > 0 {
+		sub := "SELECT match_id FROM matches"
+		if len(matchConds) > 0 {
+			sub += " WHERE " + strings.Join(matchConds, " AND ")
+		}
+		if f.LastMatches > 0 {
+			sub += fmt.Sprintf(" ORDER BY start_time IS NULL, start_time DESC, match_id DESC LIMIT %d", f.LastMatches)
+		}
+		conds = append(conds, "match_id IN ("+sub+")")
+	}
+	if len(conds) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// worldPos 眼位的世界坐标（数据库内统一按世界坐标做空间计算）：b 为该场版本的地图边界，
+// CoordSpace 为空时按 guessed（同场眼位的 coord.GuessSpace）换算
+func worldPos(w *model.WardRecord, b coord.Bounds, guessed coord.Space) (float64, float64) {
+	space := coord.Space(w.CoordSpace)
+	if space == "" {
+		space = guessed
+	}
+	return b.ToWorld(w.PosX, w.PosY, space)
+}
+
+// worldPositions 多场眼位的世界坐标，逐场按 patches 中的版本取边界、推断坐标系
+func worldPositions(wards []model.WardRecord, patches map[int64]string) [][2]float64 {
+	byMatch := map[int64][]model.WardRecord{}
+	for _, w := range wards {
+		byMatch[w.MatchID] = append(byMatch[w.MatchID], w)
+	}
+	guessed := map[int64]coord.Space{}
+	for id, ws := range byMatch {
+		guessed[id] = coord.GuessSpace(ws)
+	}
+	out := make([][2]float64, len(wards))
+	for i := range wards {
+		w := &wards[i]
+		out[i][0], out[i][1] = worldPos(w, coord.BoundsFor(patches[w.MatchID]), guessed[w.MatchID])
+	}
+	return out
+}
+
+// matchIDsOf 眼位涉及的比赛，去重
+func matchIDsOf(wards []model.WardRecord) []int64 {
+	seen := map[int64]bool{}
+	var out []int64
+	for _, w := range wards {
+		if !seen[w.MatchID] {
+			seen[w.MatchID] = true
+			out = append(out, w.MatchID)
+		}
+	}
+	return out
+}
+
+func placeholders(n int, ph func(int) string) string {
+	marks := make([]string, n)
+	for i := range marks {
+		marks[i] = ph(i + 1)
+	}
+	return strings.Join(marks, ", ")
+}
@@ -0,0 +1,211 @@
+package terrain
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cndotaplan/cndotaplan/internal/coord"
+)
+
+// 地图实体类名：地图树与视野阻挡物
+const (
+	TreeClass    = "ent_dota_tree"
+	BlockerClass = "ent_fow_blocker_node"
+)
+
+// MapOffset 地图文件中的坐标以地图中心为原点，加上 MapOffset 即 parser 的世界坐标（cell*128 + vec）
+const MapOffset = 16384
+
+// DefaultTreeRadius 一棵树挡视野的半径（世界单位）：树的原点在格子交点上，占周围 2×2 格
+const DefaultTreeRadius = 64
+
+// FromHeightmap 由地图高度图生成格子：图片每个像素对应一格，第 0 行为地图最上方（y 最大），
+// 灰度值（0–255）除以 step 向下取整为高度等级，step 为高度图中相邻两层地面相差的灰度。
+// minX、minY 为左下角格子的世界坐标。树位图为空，用 MarkTrees 填写。
+func FromHeightmap(patch string, img image.Image, minX, minY, cellSize, step float64) (*Grid, error) {
+	if step <= 0 {
+		return nil, fmt.Errorf("terrain: elevation step must be positive")
+	}
+	r := img.Bounds()
+	g := &Grid{Patch: patch, MinX: minX, MinY: minY, CellSize: cellSize, Width: r.Dx(), Height: r.Dy()}
+	if g.Width == 0 || g.Height == 0 {
+		return nil, fmt.Errorf("terrain: empty heightmap")
+	}
+	n := g.Width * g.Height
+	g.Elevation = make([]byte, n)
+	g.Trees = make([]byte, (n+7)/8)
+	for j := 0; j < g.Height; j++ {
+		for i := 0; i < g.Width; i++ {
+			// 图片 y 向下，格子 j 向上
+			gray, _, _, _ := img.At(r.Min.X+i, r.Max.Y-1-j).RGBA()
+			level := math.Floor(float64(gray>>8) / step)
+			if level > 255 {
+				level = 255
+			}
+			g.Elevation[j*g.Width+i] = byte(level)
+		}
+	}
+	return g, nil
+}
+
+// MarkTrees 把 points（世界坐标）radius 以内的格子标为有树
+func (g *Grid) MarkTrees(points []Point, radius float64) int {
+	if len(g.Trees) == 0 {
+		g.Trees = make([]byte, (g.Width*g.Height+7)/8)
+	}
+	return g.mark(g.Trees, points, radius)
+}
+
+// MarkBlockers 把 points（世界坐标）radius 以内的格子标为视野阻挡物
+func (g *Grid) MarkBlockers(points []Point, radius float64) int {
+	if len(g.Blockers) == 0 {
+		g.Blockers = make([]byte, (g.Width*g.Height+7)/8)
+	}
+	return g.mark(g.Blockers, points, radius)
+}
+
+// mark 返回新标记的格子数；每个点至少标记其所在格
+func (g *Grid) mark(bits []byte, points []Point, radius float64) int {
+	n := 0
+	set := func(k int) {
+		if !bitSet(bits, k) {
+			bits[k/8] |= 1 << (k % 8)
+			n++
+		}
+	}
+	for _, p := range points {
+		if k, ok := g.Cell(p[0], p[1]); ok {
+			set(k)
+		}
+		i0, j0 := int(math.Floor((p[0]-radius-g.MinX)/g.CellSize)), int(math.Floor((p[1]-radius-g.MinY)/g.CellSize))
+		i1, j1 := int(math.Floor((p[0]+radius-g.MinX)/g.CellSize)), int(math.Floor((p[1]+radius-g.MinY)/g.CellSize))
+		for j := j0; j <= j1; j++ {
+			for i := i0; i <= i1; i++ {
+				if i < 0 || j < 0 || i >= g.Width || j >= g.Height {
+					continue
+				}
+				if cx, cy := g.center(i, j); math.Hypot(cx-p[0], cy-p[1]) <= radius {
+					set(j*g.Width + i)
+				}
+			}
+		}
+	}
+	return n
+}
+
+// Entity 地图实体的键值
+type Entity map[string]string
+
+// ParseEntities 读取地图实体表的文本导出（Hammer / Source 2 Viewer 的 entity lump 格式）：
+// 每个实体为一对花括号，其中每行一对带引号的键值，如
+//
+//	{
+//	"classname" "ent_dota_tree"
+//	"origin" "-6912 5376 128"
+//	}
+func ParseEntities(r io.Reader) ([]Entity, error) {
+	var out []Entity
+	var cur Entity
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		s := strings.TrimSpace(sc.Text())
+		switch {
+		case s == "" || strings.HasPrefix(s, "//"):
+		case s == "{":
+			if cur != nil {
+				return nil, fmt.Errorf("terrain: entities line %d: nested '{'", line)
+			}
+			cur = Entity{}
+		case s == "}":
+			if cur == nil {
+				return nil, fmt.Errorf("terrain: entities line %d: unexpected '}'", line)
+			}
+			out = append(out, cur)
+			cur = nil
+		default:
+			if cur == nil {
+				return nil, fmt.Errorf("terrain: entities line %d: key outside entity", line)
+			}
+			k, v, ok := keyValue(s)
+			if !ok {
+				return nil, fmt.Errorf("terrain: entities line %d: want \"key\" \"value\"", line)
+			}
+			cur[k] = v
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if cur != nil {
+		return nil, fmt.Errorf("terrain: entities: unterminated entity")
+	}
+	return out, nil
+}
+
+func keyValue(s string) (string, string, bool) {
+	k, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return "", "", false
+	}
+	rest := strings.TrimSpace(s[len(k):])
+	v, err := strconv.QuotedPrefix(rest)
+	if err != nil {
+		return "", "", false
+	}
+	k, _ = strconv.Unquote(k)
+	v, _ = strconv.Unquote(v)
+	return k, v, true
+}
+
+// Origins classname 实体的 origin，已加上 MapOffset 换算为世界坐标 x、y
+func Origins(ents []Entity, classname string) ([]Point, error) {
+	var out []Point
+	for _, e := range ents {
+		if e["classname"] != classname {
+			continue
+		}
+		f := strings.Fields(e["origin"])
+		if len(f) < 2 {
+			return nil, fmt.Errorf("terrain: %s without origin", classname)
+		}
+		x, errX := strconv.ParseFloat(f[0], 64)
+		y, errY := strconv.ParseFloat(f[1], 64)
+		if errX != nil || errY != nil {
+			return nil, fmt.Errorf("terrain: %s origin %q", classname, e["origin"])
+		}
+		out = append(out, Point{x + MapOffset, y + MapOffset})
+	}
+	return out, nil
+}
+
+// Put 加入或替换同一版本的格子
+func (f *File) Put(g *Grid) {
+	for i, old := range f.Patches {
+		if old.Patch == g.Patch {
+			f.Patches[i] = g
+			return
+		}
+	}
+	f.Patches = append(f.Patches, g)
+	sort.Slice(f.Patches, func(i, j int) bool { return coord.ComparePatch(f.Patches[i].Patch, f.Patches[j].Patch) < 0 })
+}
+
+// Save 写入地形文件
+func (f *File) Save(path string) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,240 @@
+// Package terrain 按版本的地形格子（高度、树、视野阻挡）与基于视线的眼位可见区域。
+//
+// Dota 的视野规则：单位看不到比自己所在格更高的地面，更高的格子、树与视野阻挡物会挡住其后方。
+// 格子数据从地图文件导出（高度图与实体表，见 convert.go 与 cmd/terrain），按 File 格式保存，
+// 用 Open / LoadFile 读入。没有地形文件时不做遮挡计算，调用方只按视野半径画圆。
+package terrain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/cndotaplan/cndotaplan/internal/coord"
+)
+
+// DefaultCellSize 格子边长（世界单位），与游戏 GridNav 一致
+const DefaultCellSize = 64
+
+// DefaultRays Polygon 默认的射线数
+const DefaultRays = 180
+
+// Point 坐标 [x, y]
+type Point [2]float64
+
+// Grid 一个版本的地形格子。第 (i, j) 格覆盖世界坐标 [MinX+i*CellSize, MinX+(i+1)*CellSize) ×
+// [MinY+j*CellSize, ...)，数据按行存放，下标 j*Width+i。
+type Grid struct {
+	Patch    string  `json:"patch"`
+	MinX     float64 `json:"min_x"`
+	MinY     float64 `json:"min_y"`
+	CellSize float64 `json:"cell_size"`
+	Width    int     `json:"width"`
+	Height   int     `json:"height"`
+	// Elevation 每格的高度等级，越大越高；JSON 中为 base64
+	Elevation []byte `json:"elevation"`
+	// Trees / Blockers 位图（第 k 格为 [k/8]>>(k%8)&1）：地图树（ent_dota_tree）与视野阻挡物（ent_fow_blocker_node），
+	// Blockers 可为空；JSON 中为 base64
+	Trees    []byte `json:"trees,omitempty"`
+	Blockers []byte `json:"blockers,omitempty"`
+}
+
+// File 地形数据文件格式，Patches 为各版本的格子
+type File struct {
+	Version int     `json:"version"`
+	Note    string  `json:"note,omitempty"`
+	Patches []*Grid `json:"patches"`
+}
+
+// Parse 读取地形数据文件
+func Parse(r io.Reader) (*File, error) {
+	var f File
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("terrain: decode: %w", err)
+	}
+	if len(f.Patches) == 0 {
+		return nil, fmt.Errorf("terrain: no patches")
+	}
+	for _, g := range f.Patches {
+		if g.CellSize <= 0 || g.Width <= 0 || g.Height <= 0 {
+			return nil, fmt.Errorf("terrain: patch %s: invalid grid size", g.Patch)
+		}
+		n := g.Width * g.Height
+		if len(g.Elevation) != n {
+			return nil, fmt.Errorf("terrain: patch %s: elevation has %d cells, want %d", g.Patch, len(g.Elevation), n)
+		}
+		if len(g.Trees) != (n+7)/8 {
+			return nil, fmt.Errorf("terrain: patch %s: tree bitmap has %d bytes, want %d", g.Patch, len(g.Trees), (n+7)/8)
+		}
+		if len(g.Blockers) != 0 && len(g.Blockers) != (n+7)/8 {
+			return nil, fmt.Errorf("terrain: patch %s: blocker bitmap has %d bytes, want %d", g.Patch, len(g.Blockers), (n+7)/8)
+		}
+	}
+	sort.Slice(f.Patches, func(i, j int) bool { return coord.ComparePatch(f.Patches[i].Patch, f.Patches[j].Patch) < 0 })
+	return &f, nil
+}
+
+// LoadFile 从外部文件读取地形数据
+func LoadFile(path string) (*File, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	return Parse(fh)
+}
+
+// ForPatch 取不晚于 patch 的最新版本；patch 为空或早于所有版本时用最新/最早的兜底
+func (f *File) ForPatch(patch string) *Grid {
+	if patch == "" {
+		return f.Patches[len(f.Patches)-1]
+	}
+	best := f.Patches[0]
+	for _, g := range f.Patches {
+		if coord.ComparePatch(g.Patch, patch) <= 0 {
+			best = g
+		}
+	}
+	return best
+}
+
+// ErrNoTerrain 没有指定地形文件
+var ErrNoTerrain = errors.New("terrain: no terrain file (export one from the map with cmd/terrain)")
+
+// Open 从 path 读取地形文件并取 patch 的格子。path 为空、文件中没有不晚于 patch 的版本时返回错误，
+// 不会退回到近似数据
+func Open(path, patch string) (*Grid, error) {
+	if path == "" {
+		return nil, ErrNoTerrain
+	}
+	f, err := LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	g := f.ForPatch(patch)
+	if patch != "" && coord.ComparePatch(g.Patch, patch) > 0 {
+		return nil, fmt.Errorf("terrain: %s has no grid for patch %s (earliest is %s)", path, patch, g.Patch)
+	}
+	return g, nil
+}
+
+func (g *Grid) center(i, j int) (float64, float64) {
+	return g.MinX + (float64(i)+0.5)*g.CellSize, g.MinY + (float64(j)+0.5)*g.CellSize
+}
+
+// Cell 世界坐标所在格的下标，超出范围时返回 false
+func (g *Grid) Cell(x, y float64) (int, bool) {
+	i := int(math.Floor((x - g.MinX) / g.CellSize))
+	j := int(math.Floor((y - g.MinY) / g.CellSize))
+	if i < 0 || j < 0 || i >= g.Width || j >= g.Height {
+		return 0, false
+	}
+	return j*g.Width + i, true
+}
+
+// ElevationAt 世界坐标处的高度等级，超出范围为 0
+func (g *Grid) ElevationAt(x, y float64) byte {
+	if k, ok := g.Cell(x, y); ok {
+		return g.Elevation[k]
+	}
+	return 0
+}
+
+// Tree 第 k 格是否有树
+func (g *Grid) Tree(k int) bool {
+	return bitSet(g.Trees, k)
+}
+
+// Blocker 第 k 格是否有视野阻挡物
+func (g *Grid) Blocker(k int) bool {
+	return bitSet(g.Blockers, k)
+}
+
+// treeOverrides changes 覆盖到的格子 → 是否有树
+func (g *Grid) treeOverrides(changes []TreeChange) map[int]bool {
+	if len(changes) == 0 {
+		return nil
+	}
+	out := map[int]bool{}
+	for _, c := range changes {
+		if c.Planted {
+			if k, ok := g.Cell(c.X, c.Y); ok {
+				out[k] = true
+			}
+			continue
+		}
+		i0, j0 := int(math.Floor((c.X-c.Radius-g.MinX)/g.CellSize)), int(math.Floor((c.Y-c.Radius-g.MinY)/g.CellSize))
+		i1, j1 := int(math.Floor((c.X+c.Radius-g.MinX)/g.CellSize)), int(math.Floor((c.Y+c.Radius-g.MinY)/g.CellSize))
+		for j := j0; j <= j1; j++ {
+			for i := i0; i <= i1; i++ {
+				if i < 0 || j < 0 || i >= g.Width || j >= g.Height {
+					continue
+				}
+				if cx, cy := g.center(i, j); math.Hypot(cx-c.X, cy-c.Y) <= c.Radius {
+					out[j*g.Width+i] = false
+				}
+			}
+		}
+	}
+	return out
+}
+
+func treeAt(g *Grid, overrides map[int]bool, k int) bool {
+	if v, ok := overrides[k]; ok {
+		return v
+	}
+	return g.Tree(k)
+}
+
+func bitSet(bits []byte, k int) bool {
+	return k/8 < len(bits) && bits[k/8]>>(k%8)&1 == 1
+}
+
+// Polygon 世界坐标 (x, y) 处、半径 radius 的地面视野的可见区域：rays 条等角射线各自走到
+// 第一个挡住视线的格子（比起点高、树、阻挡物）或半径为止，返回按逆时针排列的端点（世界坐标）。
+// rays <= 0 时用 DefaultRays。
+func (g *Grid) Polygon(x, y, radius float64, rays int) []Point {
+	return g.PolygonWithTrees(x, y, radius, rays, nil)
+}
+
+// TreeChange 相对格子数据的树变化（世界坐标）：以 (X, Y) 为中心 Radius 内的树被砍掉，
+// 或 Planted 时 (X, Y) 处有一棵临时树
+type TreeChange struct {
+	X, Y    float64
+	Radius  float64
+	Planted bool
+}
+
+// PolygonWithTrees 与 Polygon 相同，但先在格子数据上应用 changes（按顺序，后者覆盖前者）
+func (g *Grid) PolygonWithTrees(x, y, radius float64, rays int, changes []TreeChange) []Point {
+	trees := g.treeOverrides(changes)
+	if rays <= 0 {
+		rays = DefaultRays
+	}
+	eye := g.ElevationAt(x, y)
+	start, _ := g.Cell(x, y)
+	step := g.CellSize / 4
+	out := make([]Point, rays)
+	for r := 0; r < rays; r++ {
+		a := 2 * math.Pi * float64(r) / float64(rays)
+		dx, dy := math.Cos(a), math.Sin(a)
+		d := 0.0
+		for d < radius {
+			next := math.Min(d+step, radius)
+			k, ok := g.Cell(x+dx*next, y+dy*next)
+			if !ok {
+				break
+			}
+			if k != start && (g.Elevation[k] > eye || g.Blocker(k) || treeAt(g, trees, k)) {
+				break
+			}
+			d = next
+		}
+		out[r] = Point{x + dx*d, y + dy*d}
+	}
+	return out
+}
@@ -0,0 +1,134 @@
+package terrain
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const entities = `// dota.vmap entities
+{
+"classname" "ent_dota_tree"
+"origin" "-8064 -8064 128"
+}
+{
+"classname" "info_player_start_goodguys"
+"origin" "-7000 -6500 256"
+}
+{
+"classname" "ent_fow_blocker_node"
+"origin" "-7680 -8000 0"
+}
+`
+
+// testGrid 8×8 格、64 单位一格，右半边（i >= 4）高一层，位于世界坐标 (8192, 8192) 起
+func testGrid(t *testing.T) *Grid {
+	img := image.NewGray(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			v := uint8(64)
+			if x >= 4 {
+				v = 128
+			}
+			img.SetGray(x, y, color.Gray{v})
+		}
+	}
+	// 图片最上一行（y = 0）是地图最上方，左上角单独标成 0 层
+	img.SetGray(0, 0, color.Gray{0})
+	g, err := FromHeightmap("7.40", img, 8192, 8192, DefaultCellSize, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestFromHeightmap(t *testing.T) {
+	g := testGrid(t)
+	if g.Width != 8 || g.Height != 8 || len(g.Trees) != 8 {
+		t.Fatalf("grid %dx%d, %d tree bytes", g.Width, g.Height, len(g.Trees))
+	}
+	if e := g.ElevationAt(8192+32, 8192+7*64+32); e != 0 {
+		t.Errorf("top-left cell elevation %d, want 0 (image row 0 is the top)", e)
+	}
+	if e := g.ElevationAt(8192+32, 8192+32); e != 1 {
+		t.Errorf("bottom-left cell elevation %d, want 1", e)
+	}
+	if e := g.ElevationAt(8192+6*64, 8192+32); e != 2 {
+		t.Errorf("right half elevation %d, want 2", e)
+	}
+	if _, err := FromHeightmap("7.40", image.NewGray(image.Rect(0, 0, 0, 0)), 0, 0, 64, 64); err == nil {
+		t.Error("empty heightmap accepted")
+	}
+}
+
+func TestEntities(t *testing.T) {
+	ents, err := ParseEntities(strings.NewReader(entities))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ents) != 3 {
+		t.Fatalf("%d entities, want 3", len(ents))
+	}
+	trees, err := Origins(ents, TreeClass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trees) != 1 || trees[0] != (Point{-8064 + MapOffset, -8064 + MapOffset}) {
+		t.Errorf("tree origins %v", trees)
+	}
+	for _, bad := range []string{"{\n\"classname\"\n}", "{\n{\n", "}\n", "{\n\"a\" \"b\"\n"} {
+		if _, err := ParseEntities(strings.NewReader(bad)); err == nil {
+			t.Errorf("ParseEntities(%q) accepted", bad)
+		}
+	}
+	if _, err := Origins([]Entity{{"classname": TreeClass}}, TreeClass); err == nil {
+		t.Error("tree without origin accepted")
+	}
+}
+
+func TestPolygonBlocked(t *testing.T) {
+	g := testGrid(t)
+	ents, _ := ParseEntities(strings.NewReader(entities))
+	trees, _ := Origins(ents, TreeClass)
+	if n := g.MarkTrees(trees, DefaultTreeRadius); n == 0 {
+		t.Fatal("no tree cells marked")
+	}
+	// 树在第 2 列、第 2 行的格点上，占 (1–2, 1–2) 四格。眼在 (1, 5) 格中心：
+	// 向右走到第 4 列的高地为止，向下走到第 2 行的树为止
+	x, y := 8192+1.5*64, 8192+5.5*64
+	poly := g.Polygon(x, y, 1000, 4)
+	if d := poly[0][0] - x; d > 2.5*64 || d < 2*64 {
+		t.Errorf("ray east reached %v, want to stop at the high ground", d)
+	}
+	if d := y - poly[3][1]; d > 2.5*64 || d < 2*64 {
+		t.Errorf("ray south reached %v, want to stop at the tree", d)
+	}
+	// 砍掉树后可以看到格子边缘
+	poly = g.PolygonWithTrees(x, y, 1000, 4, []TreeChange{{X: trees[0][0], Y: trees[0][1], Radius: 200}})
+	if d := y - poly[3][1]; math.Abs(d-5.5*64) > 16 {
+		t.Errorf("ray south after cut reached %v, want the grid edge", d)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	if _, err := Open("", "7.40"); !errors.Is(err, ErrNoTerrain) {
+		t.Errorf("Open without a file: %v, want ErrNoTerrain", err)
+	}
+	path := filepath.Join(t.TempDir(), "terrain.json")
+	f := &File{Version: 1}
+	f.Put(testGrid(t))
+	if err := f.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	g, err := Open(path, "7.40b")
+	if err != nil || g.Patch != "7.40" {
+		t.Errorf("Open 7.40b = %v, %v", g, err)
+	}
+	if _, err := Open(path, "7.33"); err == nil {
+		t.Error("Open for a patch older than the file succeeded")
+	}
+}
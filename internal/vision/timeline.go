@@ -0,0 +1,186 @@
+package vision
+
+import (
+	"math"
+	"sort"
+
+	"github.com/cndotaplan/cndotaplan/internal/coord"
+	"github.com/cndotaplan/cndotaplan/internal/model"
+	"github.com/cndotaplan/cndotaplan/internal/terrain"
+)
+
+// NightStalker 暗夜猎手英雄名；其黑暗飞升（Dark Ascension）制造临时夜晚
+const NightStalker = "npc_dota_hero_night_stalker"
+
+// Timeline 一场比赛的昼夜：号角起的固定昼夜循环，叠加录像中的临时夜晚（model.VisionNight 事件，
+// 如黑暗飞升、月蚀）。零值只有固定循环，可用于没有视野事件的比赛（OpenDota）。
+type Timeline struct {
+	nights []model.VisionEvent // 临时夜晚，按开始时间升序
+}
+
+// NewTimeline 从视野事件中取出临时夜晚；其它事件忽略
+func NewTimeline(events []model.VisionEvent) Timeline {
+	var t Timeline
+	for _, ev := range events {
+		if ev.Kind == model.VisionNight && ev.DurationSec > 0 {
+			t.nights = append(t.nights, ev)
+		}
+	}
+	sort.Slice(t.nights, func(i, j int) bool { return t.nights[i].GameTimeSec < t.nights[j].GameTimeSec })
+	return t
+}
+
+// temporaryNight sec 时正在生效的临时夜晚
+func (t Timeline) temporaryNight(sec float64) (model.VisionEvent, bool) {
+	for _, ev := range t.nights {
+		if ev.GameTimeSec > sec {
+			break
+		}
+		if sec < ev.GameTimeSec+ev.DurationSec {
+			return ev, true
+		}
+	}
+	return model.VisionEvent{}, false
+}
+
+// Night sec 时是否为夜晚（固定循环或临时夜晚）
+func (t Timeline) Night(sec float64) bool {
+	_, ok := t.temporaryNight(sec)
+	return ok || IsNight(sec)
+}
+
+// DarkAscension sec 时是否处于暗夜猎手的黑暗飞升
+func (t Timeline) DarkAscension(sec float64) bool {
+	ev, ok := t.temporaryNight(sec)
+	return ok && ev.HeroName == NightStalker
+}
+
+// Window 一段视野半径不变的时间
+type Window struct {
+	StartSec      float64 `json:"start_sec"`
+	EndSec        float64 `json:"end_sec"`
+	Radius        float64 `json:"radius"`
+	Night         bool    `json:"night"`
+	DarkAscension bool    `json:"dark_ascension,omitempty"`
+	// Polygon 考虑地形遮挡后的可见区域（见 WithTerrain），为空时按半径画圆
+	Polygon []terrain.Point `json:"polygon,omitempty"`
+	// Trees 计算 Polygon 时生效的附近树变化数（砍掉或种下）
+	Trees int `json:"trees,omitempty"`
+}
+
+// Windows 把 [start, end) 按昼夜切换与临时夜晚的边界切分，给出每段 wardType 的视野半径；
+// 相邻且状态相同的段合并。
+func (t Timeline) Windows(wardType string, start, end float64, cfg Config) []Window {
+	if end <= start {
+		return nil
+	}
+	cuts := []float64{start, end}
+	for c := math.Ceil(start/DayNightCycleSec) * DayNightCycleSec; c < end; c += DayNightCycleSec {
+		if c > start {
+			cuts = append(cuts, c)
+		}
+	}
+	for _, ev := range t.nights {
+		for _, c := range []float64{ev.GameTimeSec, ev.GameTimeSec + ev.DurationSec} {
+			if c > start && c < end {
+				cuts = append(cuts, c)
+			}
+		}
+	}
+	sort.Float64s(cuts)
+	var out []Window
+	for i := 0; i+1 < len(cuts); i++ {
+		a, b := cuts[i], cuts[i+1]
+		if b <= a {
+			continue
+		}
+		night, dark := t.Night(a), t.DarkAscension(a)
+		if n := len(out); n > 0 && out[n-1].Night == night && out[n-1].DarkAscension == dark {
+			out[n-1].EndSec = b
+			continue
+		}
+		out = append(out, Window{StartSec: a, EndSec: b, Radius: cfg.Radius(wardType, night), Night: night, DarkAscension: dark})
+	}
+	return out
+}
+
+// WardWindows 眼存活期间的视野半径分段
+func (t Timeline) WardWindows(w *model.WardRecord, cfg Config) []Window {
+	return t.Windows(w.WardType, w.GameTimeSec, w.GameTimeSec+w.DurationSec, cfg)
+}
+
+// WithTerrain 为每段填写世界坐标 (x, y) 处按该段半径的视线可见区域（世界坐标）。
+// trees 为该场的砍树与临时树：影响范围够到眼的视野的变化在其开始与结束时刻再切分时间段，
+// 每段按段首时刻的树状态计算。返回切分后的分段；g 为 nil（没有地形数据）时原样返回。
+func WithTerrain(ws []Window, g *terrain.Grid, trees []model.TreeEvent, x, y float64) []Window {
+	if g == nil {
+		return ws
+	}
+	type change struct {
+		ev     *model.TreeEvent
+		change terrain.TreeChange
+	}
+	var near []change
+	maxR := 0.0
+	for _, w := range ws {
+		maxR = math.Max(maxR, w.Radius)
+	}
+	for i := range trees {
+		if c, ok := treeChangeNear(&trees[i], g, x, y, maxR); ok {
+			near = append(near, change{&trees[i], c})
+		}
+	}
+	var out []Window
+	for _, w := range ws {
+		cuts := []float64{w.StartSec, w.EndSec}
+		for _, c := range near {
+			for _, t := range []float64{c.ev.GameTimeSec, c.ev.GameTimeSec + c.ev.DurationSec} {
+				if t > w.StartSec && t < w.EndSec {
+					cuts = append(cuts, t)
+				}
+			}
+		}
+		sort.Float64s(cuts)
+		for i := 0; i+1 < len(cuts); i++ {
+			if cuts[i+1] <= cuts[i] {
+				continue
+			}
+			piece := w
+			piece.StartSec, piece.EndSec = cuts[i], cuts[i+1]
+			var active []terrain.TreeChange
+			for _, c := range near {
+				if c.ev.Active(piece.StartSec) {
+					active = append(active, c.change)
+				}
+			}
+			piece.Trees = len(active)
+			piece.Polygon = g.PolygonWithTrees(x, y, piece.Radius, terrain.DefaultRays, active)
+			out = append(out, piece)
+		}
+	}
+	return out
+}
+
+// TreesAt 游戏时间 sec 时生效、影响范围够到世界坐标 (x, y) 半径 radius 以内视野的树变化，
+// 用于按某一时刻的树状态计算可见区域（terrain.Grid.PolygonWithTrees）
+func TreesAt(trees []model.TreeEvent, g *terrain.Grid, sec, x, y, radius float64) []terrain.TreeChange {
+	var out []terrain.TreeChange
+	for i := range trees {
+		if !trees[i].Active(sec) {
+			continue
+		}
+		if c, ok := treeChangeNear(&trees[i], g, x, y, radius); ok {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// treeChangeNear ev 的世界坐标与范围；够不到 (x, y) 半径 radius 以内时返回 false
+func treeChangeNear(ev *model.TreeEvent, g *terrain.Grid, x, y, radius float64) (terrain.TreeChange, bool) {
+	tx, ty := coord.BoundsFor("").ToWorld(ev.PosX, ev.PosY, coord.Space(ev.CoordSpace))
+	if math.Hypot(tx-x, ty-y) > radius+ev.Radius+g.CellSize {
+		return terrain.TreeChange{}, false
+	}
+	return terrain.TreeChange{X: tx, Y: ty, Radius: ev.Radius, Planted: ev.Kind == model.TreePlanted}, true
+}
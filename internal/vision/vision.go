@@ -0,0 +1,112 @@
+// Package vision 眼位视野：按眼的类型与昼夜计算视野半径，并结合英雄位置采样（model.HeroTrack）
+// 统计每个眼实际看到的敌方英雄。
+package vision
+
+import (
+	"math"
+
+	"github.com/cndotaplan/cndotaplan/internal/coord"
+	"github.com/cndotaplan/cndotaplan/internal/model"
+)
+
+// Config 视野半径（世界单位）
+type Config struct {
+	ObserverDay     float64 // 假眼白天视野
+	ObserverNight   float64 // 假眼夜晚视野
+	SentryTrueSight float64 // 真眼真视范围，不分昼夜
+}
+
+// Default 当前版本的默认半径
+var Default = Config{ObserverDay: 1600, ObserverNight: 1000, SentryTrueSight: 900}
+
+// Radius wardType（"observer" | "sentry"）在白天/夜晚的半径
+func (c Config) Radius(wardType string, night bool) float64 {
+	if wardType == "sentry" {
+		return c.SentryTrueSight
+	}
+	if night {
+		return c.ObserverNight
+	}
+	return c.ObserverDay
+}
+
+// DayNightCycleSec 昼夜各持续的游戏时间（秒），号角起先白天
+const DayNightCycleSec = 300
+
+// IsNight 固定昼夜循环下游戏时间 sec 是否为夜晚，按号角推算，开局前视为白天；
+// 临时夜晚见 Timeline。
+func IsNight(sec float64) bool {
+	if sec < 0 {
+		return false
+	}
+	return int(sec/DayNightCycleSec)%2 == 1
+}
+
+// Spotted 原地填写每个眼的 SpottedHeroSec / SpottedHeroes / RevealedWards：
+//
+//   - 假眼：存活期间视野半径内存活敌方英雄的累计秒数，以及出现过的不同英雄数
+//   - 真眼：存活期间真视范围内处于隐身状态的敌方英雄秒数与英雄数，以及范围内同时存活的敌方眼数
+//
+// 按轨迹采样点离散累加，每个采样计 IntervalSec 秒，假眼半径随 tl 的昼夜变化；
+// 没有轨迹（未开启采样）时英雄相关字段保持为 0。不考虑地形与树木遮挡。
+func Spotted(wards []model.WardRecord, tracks []model.HeroTrack, tl Timeline, cfg Config) {
+	b := coord.BoundsFor("")
+	pos := make([][2]float64, len(wards))
+	for i := range wards {
+		w := &wards[i]
+		pos[i][0], pos[i][1] = b.ToWorld(w.PosX, w.PosY, coord.Space(w.CoordSpace))
+	}
+	for i := range wards {
+		w := &wards[i]
+		w.SpottedHeroSec, w.SpottedHeroes, w.RevealedWards = 0, 0, 0
+		if w.PosX == 0 && w.PosY == 0 {
+			continue // 未解析出坐标
+		}
+		x, y := pos[i][0], pos[i][1]
+		start, end := w.GameTimeSec, w.GameTimeSec+w.DurationSec
+		sentry := w.WardType == "sentry"
+		for j := range tracks {
+			t := &tracks[j]
+			if t.TeamID == w.TeamID || t.IntervalSec <= 0 {
+				continue
+			}
+			seen := false
+			k, _ := t.Index(start)
+			if start < t.StartSec {
+				k = 0
+			}
+			for ; k < t.Len() && t.TimeAt(k) < end; k++ {
+				if t.TimeAt(k) < start {
+					continue
+				}
+				hx, hy, alive := t.At(k)
+				if !alive || (sentry && !t.InvisibleAt(k)) {
+					continue
+				}
+				r := cfg.Radius(w.WardType, tl.Night(t.TimeAt(k)))
+				if math.Hypot(hx-x, hy-y) <= r {
+					w.SpottedHeroSec += t.IntervalSec
+					seen = true
+				}
+			}
+			if seen {
+				w.SpottedHeroes++
+			}
+		}
+		if !sentry {
+			continue
+		}
+		for j := range wards {
+			o := &wards[j]
+			if o.TeamID == w.TeamID || (o.PosX == 0 && o.PosY == 0) {
+				continue
+			}
+			if o.GameTimeSec >= end || o.GameTimeSec+o.DurationSec <= start {
+				continue
+			}
+			if math.Hypot(pos[j][0]-x, pos[j][1]-y) <= cfg.SentryTrueSight {
+				w.RevealedWards++
+			}
+		}
+	}
+}
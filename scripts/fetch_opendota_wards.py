@@ -41,6 +41,7 @@ def main() -> None:
     for p in players:
         player_slot = p.get("player_slot", 0)
         team_id = 2 if player_slot < 128 else 3
+        player_name = p.get("name") or p.get("personaname") or ""
         for log_key, ward_type in [("obs_log", "observer"), ("sen_log", "sentry")]:
             for e in p.get(log_key) or []:
                 x = e.get("x")
@@ -54,8 +55,13 @@ def main() -> None:
                     "match_id": match_id,
                     "team_id": team_id,
                     "ward_type": ward_type,
+                    "player_slot": player_slot,
+                    "account_id": p.get("account_id") or 0,
+                    "player_name": player_name,
+                    "hero_id": p.get("hero_id") or 0,
                     "pos_x": float(x),
                     "pos_y": float(y),
+                    "coord_space": "opendota_grid",
                     "game_time_sec": float(t),
                     "duration_sec": 0,
                     "is_denied": False,